@@ -0,0 +1,109 @@
+package fsutil
+
+import (
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// WriteFileAtomic writes data to the given file atomically. The data is written to
+// a temporary file in the same directory, which is then synced and renamed over the
+// target, so readers see either the old or the new content, never a partial one.
+// If the file exists, its mode and owner are kept, otherwise it is created with perm
+// before umask like os.WriteFile. A symlink is followed, the file it points to is
+// replaced and the link is kept.
+func WriteFileAtomic(fpath string, data []byte, perm os.FileMode) error {
+	return writeFileAtomic(fpath, perm, true, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// CopyFileAtomic is like CopyFile but replaces dst atomically like WriteFileAtomic.
+// dst gets the mode of src like CopyFile, and keeps its owner if it exists. A symlink
+// is followed like WriteFileAtomic.
+func CopyFileAtomic(src, dst string) error {
+	sfd, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = sfd.Close() }()
+
+	info, err := sfd.Stat()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, info.Mode().Perm(), false, func(w io.Writer) error {
+		_, err := io.Copy(w, sfd)
+		return err
+	})
+}
+
+// writeFileAtomic writes the target through a temporary file, keepMode reports
+// whether to keep the mode of an existing target, otherwise the mode is set to perm.
+func writeFileAtomic(fpath string, perm os.FileMode, keepMode bool, write func(w io.Writer) error) (err error) {
+	// renaming over a symlink would replace the link instead of the file it points to
+	if resolved, err := filepath.EvalSymlinks(fpath); err == nil {
+		fpath = resolved
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	dir := filepath.Dir(fpath)
+	target, err := os.Stat(fpath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	chmod := !keepMode || target != nil
+	if target != nil && keepMode {
+		perm = target.Mode().Perm()
+	}
+
+	tmp, err := createTemp(dir, "."+filepath.Base(fpath)+".tmp", perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if chmod {
+		if err = tmp.Chmod(perm); err != nil {
+			return err
+		}
+	}
+	if target != nil {
+		if err = chownLike(tmp, target); err != nil {
+			return err
+		}
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), fpath); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// createTemp creates a new file in dir like os.CreateTemp, but with perm before umask.
+func createTemp(dir, prefix string, perm os.FileMode) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 36))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && i < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
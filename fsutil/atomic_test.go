@@ -0,0 +1,106 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "config.yaml")
+
+	t.Run("create file", func(t *testing.T) {
+		err := WriteFileAtomic(fp, []byte("v1"), 0o600)
+		assert.NoError(t, err)
+		got, err := os.ReadFile(fp)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", string(got))
+		info, err := os.Stat(fp)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("replace file and keep mode", func(t *testing.T) {
+		err := WriteFileAtomic(fp, []byte("v2"), 0o644)
+		assert.NoError(t, err)
+		got, err := os.ReadFile(fp)
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", string(got))
+		info, err := os.Stat(fp)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("umask", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("no umask on Windows")
+		}
+		fp := filepath.Join(t.TempDir(), "a.txt")
+		assert.NoError(t, os.WriteFile(fp, nil, 0o666))
+		want, err := os.Stat(fp)
+		assert.NoError(t, err)
+
+		fp = filepath.Join(t.TempDir(), "b.txt")
+		assert.NoError(t, WriteFileAtomic(fp, nil, 0o666))
+		info, err := os.Stat(fp)
+		assert.NoError(t, err)
+		assert.Equal(t, want.Mode().Perm(), info.Mode().Perm())
+	})
+
+	t.Run("follow symlink", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("symlinks require privileges on Windows")
+		}
+		ldir := t.TempDir()
+		file := filepath.Join(ldir, "real.yaml")
+		link := filepath.Join(ldir, "link.yaml")
+		assert.NoError(t, os.WriteFile(file, []byte("v1"), 0o644))
+		assert.NoError(t, os.Symlink("real.yaml", link))
+
+		assert.NoError(t, WriteFileAtomic(link, []byte("v2"), 0o644))
+		target, err := os.Readlink(link)
+		assert.NoError(t, err)
+		assert.Equal(t, "real.yaml", target)
+		got, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", string(got))
+	})
+
+	t.Run("no temporary file left", func(t *testing.T) {
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("directory does not exist", func(t *testing.T) {
+		err := WriteFileAtomic(filepath.Join(dir, "nodir", "a.txt"), []byte("v1"), 0o644)
+		assert.Error(t, err)
+	})
+}
+
+func TestCopyFileAtomic(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "a.txt")
+	err := os.WriteFile(dst, []byte("old content"), 0o600)
+	assert.NoError(t, err)
+
+	err = CopyFileAtomic("testdata/src/a.txt", dst)
+	assert.NoError(t, err)
+
+	want, err := os.ReadFile("testdata/src/a.txt")
+	assert.NoError(t, err)
+	got, err := os.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	sinfo, err := os.Stat("testdata/src/a.txt")
+	assert.NoError(t, err)
+	dinfo, err := os.Stat(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, sinfo.Mode().Perm(), dinfo.Mode().Perm())
+
+	assert.Error(t, CopyFileAtomic("testdata/src/nonexistent.txt", dst))
+}
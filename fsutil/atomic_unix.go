@@ -0,0 +1,31 @@
+//go:build linux || darwin
+
+package fsutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// chownLike changes the owner of f to the owner of the given file info.
+func chownLike(f *os.File, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	uid, gid := int(stat.Uid), int(stat.Gid)
+	if uid == os.Geteuid() && gid == os.Getegid() {
+		return nil
+	}
+	return f.Chown(uid, gid)
+}
+
+// syncDir flushes the directory entries, so that a rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+	return d.Sync()
+}
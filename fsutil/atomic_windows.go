@@ -0,0 +1,13 @@
+package fsutil
+
+import "os"
+
+// chownLike is a no-op on Windows.
+func chownLike(_ *os.File, _ os.FileInfo) error {
+	return nil
+}
+
+// syncDir is a no-op on Windows, directories cannot be synced.
+func syncDir(_ string) error {
+	return nil
+}
@@ -0,0 +1,411 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ExistAction tells CopyWithOptions what to do when a destination file exists.
+type ExistAction int
+
+const (
+	// ExistOverwrite overwrites the existing file, it is the default.
+	ExistOverwrite ExistAction = iota
+	// ExistSkip keeps the existing file.
+	ExistSkip
+	// ExistError stops the copy with an error that matches fs.ErrExist.
+	ExistError
+)
+
+// CopyProgress reports the progress of CopyContext.
+type CopyProgress struct {
+	FilesDone  int
+	FilesTotal int
+	BytesDone  int64
+	BytesTotal int64
+}
+
+// CopyOptions configures CopyWithOptions, the zero value copies like Copy.
+type CopyOptions struct {
+	// KeepSymlinks copies symlinks as links instead of following them.
+	KeepSymlinks bool
+	// PreserveOwner keeps the uid and gid of the source, it usually requires root.
+	PreserveOwner bool
+	// PreserveTimes keeps the modification time of the source.
+	PreserveTimes bool
+	// PreserveXattrs keeps the extended attributes of the source, only supported on Linux.
+	PreserveXattrs bool
+	// OnExist tells what to do when a destination file exists.
+	OnExist ExistAction
+	// Include is a list of glob patterns, if it is not empty, only the files matching
+	// one of them are copied. Directories are always walked.
+	Include []string
+	// Exclude is a list of glob patterns, the files and directories matching one
+	// of them are skipped.
+	Exclude []string
+	// OnEntry is called after each entry is copied, returning an error stops the copy.
+	// Directories are reported after their children.
+	OnEntry func(src, dst string, info fs.FileInfo) error
+	// Workers is the number of files copied concurrently, less than 2 means sequentially.
+	// OnEntry is never called concurrently.
+	Workers int
+	// Progress is called as files and bytes are copied, it is never called concurrently.
+	Progress func(p CopyProgress)
+	// Method is the CopyMethod used to copy regular files, defaults to CopyMethodAuto.
+	Method CopyMethod
+}
+
+// CopyError is returned when copying some entries failed. Err is the first error
+// in walk order, Errs holds all the errors in walk order.
+type CopyError struct {
+	Err  error
+	Errs []error
+}
+
+func (e *CopyError) Error() string {
+	if len(e.Errs) <= 1 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e.Err, len(e.Errs)-1)
+}
+
+func (e *CopyError) Unwrap() []error {
+	return e.Errs
+}
+
+// CopyWithOptions copies a file or directory from src to dst with the given options.
+// The glob patterns use the syntax of path.Match, and are matched against both the
+// slash-separated path relative to src and the base name of an entry.
+func CopyWithOptions(src, dst string, opts CopyOptions) error {
+	return CopyContext(context.Background(), src, dst, opts)
+}
+
+// CopyContext is like CopyWithOptions but stops when ctx is done. The directory tree is
+// created first, then the files are copied by opts.Workers workers. The copy stops
+// dispatching files after the first error, and returns a *CopyError if several
+// files failed.
+func CopyContext(ctx context.Context, src, dst string, opts CopyOptions) error {
+	return copyTree(ctx, src, dst, ".", opts)
+}
+
+// copyTree copies src to dst, rel is the path of src relative to the root that
+// the patterns are matched against.
+func copyTree(ctx context.Context, src, dst, rel string, opts CopyOptions) error {
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	c := &copier{ctx: ctx, opts: opts}
+	info, err := c.stat(src)
+	if err != nil {
+		return err
+	}
+	if err = c.plan(src, dst, rel, info); err != nil {
+		return err
+	}
+	if err = c.copyFiles(); err != nil {
+		return err
+	}
+	// the attributes of directories are set after their children are copied,
+	// so that the modification times are kept.
+	for i := len(c.dirs) - 1; i >= 0; i-- {
+		if err = c.done(c.dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type copyJob struct {
+	index int
+	src   string
+	dst   string
+	info  fs.FileInfo
+}
+
+type copier struct {
+	ctx  context.Context
+	opts CopyOptions
+
+	dirs  []copyJob
+	files []copyJob
+
+	mu       sync.Mutex
+	progress CopyProgress
+}
+
+func (c *copier) stat(fpath string) (fs.FileInfo, error) {
+	if c.opts.KeepSymlinks {
+		return os.Lstat(fpath)
+	}
+	return os.Stat(fpath)
+}
+
+// plan creates the directory tree and collects the files to copy.
+func (c *copier) plan(src, dst, rel string, info fs.FileInfo) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	if rel != "." && matchAny(c.opts.Exclude, rel) {
+		return nil
+	}
+	job := copyJob{index: len(c.dirs) + len(c.files), src: src, dst: dst, info: info}
+	switch {
+	case info.IsDir():
+		ok, err := c.mkdir(dst, info)
+		if !ok || err != nil {
+			return err
+		}
+		c.dirs = append(c.dirs, job)
+		return c.planDir(src, dst, rel)
+	case info.Mode()&fs.ModeSymlink != 0, info.Mode().IsRegular():
+		if len(c.opts.Include) > 0 && !matchAny(c.opts.Include, rel) {
+			return nil
+		}
+		c.files = append(c.files, job)
+		if info.Mode().IsRegular() {
+			c.progress.BytesTotal += info.Size()
+		}
+	default:
+		// skips devices, named pipes and sockets
+		return nil
+	}
+	c.progress.FilesTotal++
+	return nil
+}
+
+func (c *copier) planDir(src, dst, rel string) error {
+	fds, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, fd := range fds {
+		sfp := filepath.Join(src, fd.Name())
+		info, err := c.stat(sfp)
+		if err != nil {
+			return err
+		}
+		if err = c.plan(sfp, filepath.Join(dst, fd.Name()), path.Join(rel, fd.Name()), info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mkdir creates the directory dst, reports whether its children should be copied.
+// An existing file or symlink at dst is handled by OnExist, it is never written through.
+func (c *copier) mkdir(dst string, info fs.FileInfo) (bool, error) {
+	if dinfo, err := os.Lstat(dst); err == nil && !dinfo.IsDir() {
+		if ok, err := c.prepare(dst, false); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, os.MkdirAll(dst, info.Mode().Perm())
+}
+
+func (c *copier) copyFiles() error {
+	workers := c.opts.Workers
+	if workers < 2 {
+		for _, job := range c.files {
+			if err := c.copyJob(job); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make(map[int]error)
+	)
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	jobs := make(chan copyJob)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := c.copyJob(job); err != nil {
+					mu.Lock()
+					errs[job.index] = err
+					mu.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+dispatch:
+	for _, job := range c.files {
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(errs) == 0 {
+		// the parent context may be done after the last file was dispatched
+		return c.ctx.Err()
+	}
+	indexes := make([]int, 0, len(errs))
+	for index := range errs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	cerr := &CopyError{}
+	for _, index := range indexes {
+		cerr.Errs = append(cerr.Errs, errs[index])
+	}
+	cerr.Err = cerr.Errs[0]
+	if len(cerr.Errs) == 1 {
+		return cerr.Err
+	}
+	return cerr
+}
+
+func (c *copier) copyJob(job copyJob) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	var (
+		copied bool
+		err    error
+	)
+	if job.info.Mode()&fs.ModeSymlink != 0 {
+		copied, err = c.copySymlink(job.src, job.dst)
+	} else {
+		copied, err = c.copyFile(job.src, job.dst)
+	}
+	if err != nil {
+		return err
+	}
+	if !copied {
+		c.report(func(p *CopyProgress) {
+			p.FilesDone++
+			if job.info.Mode().IsRegular() {
+				p.BytesDone += job.info.Size()
+			}
+		})
+		return nil
+	}
+	if err = c.done(job); err != nil {
+		return err
+	}
+	c.report(func(p *CopyProgress) {
+		p.FilesDone++
+	})
+	return nil
+}
+
+func (c *copier) copyFile(src, dst string) (bool, error) {
+	if ok, err := c.prepare(dst, true); !ok || err != nil {
+		return false, err
+	}
+	return true, copyFile(c.ctx, src, dst, c.opts.Method, func(n int64) {
+		c.report(func(p *CopyProgress) {
+			p.BytesDone += n
+		})
+	})
+}
+
+func (c *copier) copySymlink(src, dst string) (bool, error) {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return false, err
+	}
+	if ok, err := c.prepare(dst, false); !ok || err != nil {
+		return false, err
+	}
+	return true, os.Symlink(target, dst)
+}
+
+// prepare applies OnExist to dst, reports whether dst should be written. truncate
+// tells whether a regular file is written, which can replace an existing one.
+func (c *copier) prepare(dst string, truncate bool) (bool, error) {
+	info, err := os.Lstat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch c.opts.OnExist {
+	case ExistSkip:
+		return false, nil
+	case ExistError:
+		return false, &fs.PathError{Op: "copy", Path: dst, Err: fs.ErrExist}
+	default:
+	}
+	// regular files are truncated by CopyFile, others must be removed first,
+	// so that a symlink is not written through.
+	if truncate && info.Mode().IsRegular() {
+		return true, nil
+	}
+	return true, os.RemoveAll(dst)
+}
+
+// done preserves the attributes of a copied entry and calls OnEntry.
+func (c *copier) done(job copyJob) error {
+	if err := c.preserve(job.src, job.dst, job.info); err != nil {
+		return err
+	}
+	if c.opts.OnEntry == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts.OnEntry(job.src, job.dst, job.info)
+}
+
+func (c *copier) report(update func(p *CopyProgress)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	update(&c.progress)
+	if c.opts.Progress != nil {
+		c.opts.Progress(c.progress)
+	}
+}
+
+func (c *copier) preserve(src, dst string, info fs.FileInfo) error {
+	if c.opts.PreserveOwner {
+		if err := lchown(dst, info); err != nil {
+			return err
+		}
+	}
+	if c.opts.PreserveXattrs {
+		if err := copyXattrs(src, dst); err != nil {
+			return err
+		}
+	}
+	if c.opts.PreserveTimes {
+		if err := lchtimes(dst, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, rel string) bool {
+	base := path.Base(rel)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
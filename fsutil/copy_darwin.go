@@ -0,0 +1,12 @@
+package fsutil
+
+import "syscall"
+
+func statAtime(stat *syscall.Stat_t) (sec, nsec int64) {
+	return stat.Atimespec.Unix()
+}
+
+// copyXattrs is a no-op on Darwin.
+func copyXattrs(_, _ string) error {
+	return nil
+}
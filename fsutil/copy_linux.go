@@ -0,0 +1,69 @@
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func statAtime(stat *syscall.Stat_t) (sec, nsec int64) {
+	return stat.Atim.Unix()
+}
+
+// copyXattrs copies the extended attributes of src to dst, without following symlinks.
+func copyXattrs(src, dst string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		value, err := getXattr(src, name)
+		if err != nil {
+			return err
+		}
+		if err = unix.Lsetxattr(dst, name, value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listXattrs(fpath string) ([]string, error) {
+	size, err := unix.Llistxattr(fpath, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(fpath, buf)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(fpath, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(fpath, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Lgetxattr(fpath, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,284 @@
+package fsutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCopyTree creates the following tree in a temporary directory:
+//
+//	a.txt
+//	b.log
+//	link -> a.txt
+//	sub/c.txt
+//	sub/d.log
+//	vendor/e.txt
+func newCopyTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"a.txt":        "a",
+		"b.log":        "b",
+		"sub/c.txt":    "c",
+		"sub/d.log":    "d",
+		"vendor/e.txt": "e",
+	} {
+		fp := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fp), 0o755))
+		assert.NoError(t, os.WriteFile(fp, []byte(content), 0o644))
+	}
+	assert.NoError(t, os.Symlink("a.txt", filepath.Join(root, "link")))
+	return root
+}
+
+func listTree(t *testing.T, root string) []string {
+	t.Helper()
+	var names []string
+	err := filepath.WalkDir(root, func(fpath string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, fpath)
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	sort.Strings(names)
+	return names
+}
+
+func TestCopyWithOptions(t *testing.T) {
+	t.Run("follow symlinks", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		err := CopyWithOptions(src, dst, CopyOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"a.txt", "b.log", "link", "sub", "sub/c.txt", "sub/d.log", "vendor", "vendor/e.txt",
+		}, listTree(t, dst))
+		info, err := os.Lstat(filepath.Join(dst, "link"))
+		assert.NoError(t, err)
+		assert.True(t, info.Mode().IsRegular())
+	})
+
+	t.Run("keep symlinks", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		err := CopyWithOptions(src, dst, CopyOptions{KeepSymlinks: true})
+		assert.NoError(t, err)
+		target, err := os.Readlink(filepath.Join(dst, "link"))
+		assert.NoError(t, err)
+		assert.Equal(t, "a.txt", target)
+	})
+
+	t.Run("include and exclude", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		err := CopyWithOptions(src, dst, CopyOptions{
+			Include: []string{"*.txt"},
+			Exclude: []string{"vendor", "sub/c.txt"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a.txt", "sub"}, listTree(t, dst))
+	})
+
+	t.Run("include symlinks", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		err := CopyWithOptions(src, dst, CopyOptions{KeepSymlinks: true, Include: []string{"*.log"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b.log", "sub", "sub/d.log", "vendor"}, listTree(t, dst))
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		err := CopyWithOptions(newCopyTree(t), t.TempDir(), CopyOptions{Exclude: []string{"["}})
+		assert.Error(t, err)
+	})
+
+	t.Run("on exist", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		assert.NoError(t, os.MkdirAll(dst, 0o755))
+		fp := filepath.Join(dst, "a.txt")
+		assert.NoError(t, os.WriteFile(fp, []byte("existing"), 0o644))
+
+		err := CopyWithOptions(src, dst, CopyOptions{OnExist: ExistError})
+		assert.ErrorIs(t, err, fs.ErrExist)
+
+		err = CopyWithOptions(src, dst, CopyOptions{OnExist: ExistSkip})
+		assert.NoError(t, err)
+		got, _ := os.ReadFile(fp)
+		assert.Equal(t, "existing", string(got))
+
+		err = CopyWithOptions(src, dst, CopyOptions{OnExist: ExistOverwrite})
+		assert.NoError(t, err)
+		got, _ = os.ReadFile(fp)
+		assert.Equal(t, "a", string(got))
+	})
+
+	t.Run("overwrite does not write through symlinks", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		outside := filepath.Join(t.TempDir(), "outside.txt")
+		assert.NoError(t, os.WriteFile(outside, []byte("outside"), 0o644))
+		assert.NoError(t, os.MkdirAll(dst, 0o755))
+		assert.NoError(t, os.Symlink(outside, filepath.Join(dst, "b.log")))
+
+		err := CopyWithOptions(src, dst, CopyOptions{})
+		assert.NoError(t, err)
+		got, _ := os.ReadFile(outside)
+		assert.Equal(t, "outside", string(got))
+		assert.False(t, IsSymlink(filepath.Join(dst, "b.log")))
+	})
+
+	t.Run("overwrite a file with a symlink", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		assert.NoError(t, os.MkdirAll(dst, 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, "link"), []byte("file"), 0o644))
+
+		err := CopyWithOptions(src, dst, CopyOptions{KeepSymlinks: true})
+		assert.NoError(t, err)
+		target, err := os.Readlink(filepath.Join(dst, "link"))
+		assert.NoError(t, err)
+		assert.Equal(t, "a.txt", target)
+	})
+
+	t.Run("skip does not write through existing entries", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		outside := t.TempDir()
+		assert.NoError(t, os.MkdirAll(dst, 0o755))
+		assert.NoError(t, os.Symlink(outside, filepath.Join(dst, "sub")))
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, "vendor"), []byte("file"), 0o644))
+
+		err := CopyWithOptions(src, dst, CopyOptions{OnExist: ExistSkip})
+		assert.NoError(t, err)
+		assert.Empty(t, listTree(t, outside))
+		assert.True(t, isLink(t, filepath.Join(dst, "sub")))
+		got, _ := os.ReadFile(filepath.Join(dst, "vendor"))
+		assert.Equal(t, "file", string(got))
+
+		err = CopyWithOptions(src, dst, CopyOptions{OnExist: ExistError})
+		assert.ErrorIs(t, err, fs.ErrExist)
+		assert.Empty(t, listTree(t, outside))
+	})
+
+	t.Run("preserve times", func(t *testing.T) {
+		src := newCopyTree(t)
+		mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "sub", "c.txt"), mtime, mtime))
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "sub"), mtime, mtime))
+		dst := filepath.Join(t.TempDir(), "dst")
+		err := CopyWithOptions(src, dst, CopyOptions{PreserveTimes: true, PreserveOwner: isci()})
+		assert.NoError(t, err)
+		for _, name := range []string{"sub", "sub/c.txt"} {
+			info, err := os.Stat(filepath.Join(dst, name))
+			assert.NoError(t, err)
+			assert.True(t, mtime.Equal(info.ModTime()), name)
+		}
+	})
+
+	t.Run("on entry", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		var entries []string
+		err := CopyWithOptions(src, dst, CopyOptions{
+			Exclude: []string{"vendor"},
+			OnEntry: func(src, dst string, info fs.FileInfo) error {
+				entries = append(entries, info.Name())
+				return nil
+			},
+		})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"a.txt", "b.log", "link", "c.txt", "d.log", "sub", filepath.Base(src)}, entries)
+
+		err = CopyWithOptions(src, dst, CopyOptions{
+			OnEntry: func(string, string, fs.FileInfo) error {
+				return fs.ErrInvalid
+			},
+		})
+		assert.ErrorIs(t, err, fs.ErrInvalid)
+	})
+}
+
+func TestCopyContext(t *testing.T) {
+	newLargeTree := func(t *testing.T) string {
+		root := t.TempDir()
+		for i := 0; i < 50; i++ {
+			fp := filepath.Join(root, fmt.Sprintf("dir%d", i%5), fmt.Sprintf("file%02d.txt", i))
+			assert.NoError(t, os.MkdirAll(filepath.Dir(fp), 0o755))
+			assert.NoError(t, os.WriteFile(fp, bytes.Repeat([]byte{'x'}, 1024*(i+1)), 0o644))
+		}
+		return root
+	}
+
+	t.Run("copy concurrently with progress", func(t *testing.T) {
+		src := newLargeTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		var last CopyProgress
+		calls := 0
+		err := CopyContext(context.Background(), src, dst, CopyOptions{
+			Workers: 4,
+			Progress: func(p CopyProgress) {
+				calls++
+				assert.True(t, p.BytesDone >= last.BytesDone)
+				last = p
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, calls > 0)
+		assert.Equal(t, 50, last.FilesTotal)
+		assert.Equal(t, 50, last.FilesDone)
+		assert.Equal(t, int64(1024*50*51/2), last.BytesTotal)
+		assert.Equal(t, last.BytesTotal, last.BytesDone)
+		assert.Equal(t, listTree(t, src), listTree(t, dst))
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := CopyContext(ctx, newLargeTree(t), filepath.Join(t.TempDir(), "dst"), CopyOptions{Workers: 4})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("first error in walk order", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, "sub"), 0o755))
+		for _, name := range []string{"a.txt", "b.log", "sub/c.txt"} {
+			assert.NoError(t, os.WriteFile(filepath.Join(dst, name), nil, 0o644))
+		}
+		err := CopyContext(context.Background(), src, dst, CopyOptions{Workers: 4, OnExist: ExistError})
+		assert.ErrorIs(t, err, fs.ErrExist)
+		var cerr *CopyError
+		if errors.As(err, &cerr) {
+			err = cerr.Err
+		}
+		var perr *fs.PathError
+		assert.ErrorAs(t, err, &perr)
+		assert.Equal(t, filepath.Join(dst, "a.txt"), perr.Path)
+	})
+}
+
+func TestCopyError(t *testing.T) {
+	first, second := errors.New("first"), errors.New("second")
+	err := &CopyError{Err: first, Errs: []error{first, second}}
+	assert.Equal(t, "first (and 1 more errors)", err.Error())
+	assert.ErrorIs(t, err, second)
+}
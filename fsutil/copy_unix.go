@@ -0,0 +1,35 @@
+//go:build linux || darwin
+
+package fsutil
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// lchown changes the owner of fpath to the owner of info, without following symlinks.
+func lchown(fpath string, info fs.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return os.Lchown(fpath, int(stat.Uid), int(stat.Gid))
+}
+
+// lchtimes changes the modification time of fpath to the one of info, without following symlinks.
+func lchtimes(fpath string, info fs.FileInfo) error {
+	mtime := info.ModTime()
+	atime := mtime
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		atime = time.Unix(statAtime(stat))
+	}
+	ts := []unix.Timespec{
+		unix.NsecToTimespec(atime.UnixNano()),
+		unix.NsecToTimespec(mtime.UnixNano()),
+	}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, fpath, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
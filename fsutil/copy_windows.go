@@ -0,0 +1,22 @@
+package fsutil
+
+import (
+	"io/fs"
+	"os"
+)
+
+// lchown is a no-op on Windows.
+func lchown(_ string, _ fs.FileInfo) error {
+	return nil
+}
+
+// lchtimes changes the modification time of fpath to the one of info,
+// symlinks are followed on Windows.
+func lchtimes(fpath string, info fs.FileInfo) error {
+	return os.Chtimes(fpath, info.ModTime(), info.ModTime())
+}
+
+// copyXattrs is a no-op on Windows.
+func copyXattrs(_, _ string) error {
+	return nil
+}
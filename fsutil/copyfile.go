@@ -0,0 +1,114 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// CopyMethod is the way CopyFile copies the content of a file.
+type CopyMethod int
+
+const (
+	// CopyMethodAuto tries the fastest methods supported by the platform
+	// and the file system first, then falls back to CopyMethodStream.
+	CopyMethodAuto CopyMethod = iota
+	// CopyMethodReflink shares the data blocks with the FICLONE ioctl,
+	// only supported on Linux by some file systems such as btrfs and xfs.
+	CopyMethodReflink
+	// CopyMethodCopyFileRange copies in the kernel with copy_file_range, only supported on Linux.
+	CopyMethodCopyFileRange
+	// CopyMethodSendfile copies in the kernel with sendfile, only supported on Linux.
+	CopyMethodSendfile
+	// CopyMethodStream copies through a buffer in user space.
+	CopyMethodStream
+)
+
+func (m CopyMethod) String() string {
+	switch m {
+	case CopyMethodAuto:
+		return "auto"
+	case CopyMethodReflink:
+		return "reflink"
+	case CopyMethodCopyFileRange:
+		return "copy_file_range"
+	case CopyMethodSendfile:
+		return "sendfile"
+	case CopyMethodStream:
+		return "stream"
+	default:
+		return fmt.Sprintf("unknown copy method: %d", int(m))
+	}
+}
+
+// copyChunkSize is the maximum number of bytes copied at once,
+// so that ctx is checked and the progress is reported regularly.
+const copyChunkSize = 8 << 20
+
+// copyFile copies a file from src to dst, stops when ctx is done,
+// progress is called with the number of bytes written if it is not nil.
+func copyFile(ctx context.Context, src, dst string, method CopyMethod, progress func(n int64)) (err error) {
+	sfd, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer func() { _ = sfd.Close() }()
+
+	info, err := sfd.Stat()
+	if err != nil {
+		return err
+	}
+
+	dfd, err := os.OpenFile(dst,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return
+	}
+	defer func() { _ = dfd.Close() }()
+
+	if progress == nil {
+		progress = func(int64) {}
+	}
+	if err = copyContents(ctx, dfd, sfd, info.Size(), method, progress); err != nil {
+		return err
+	}
+	return os.Chmod(dst, info.Mode())
+}
+
+func unsupportedMethod(method CopyMethod, err error) error {
+	if err == nil {
+		return fmt.Errorf("copy method %s: %w", method, errors.ErrUnsupported)
+	}
+	return fmt.Errorf("copy method %s: %w: %w", method, errors.ErrUnsupported, err)
+}
+
+// streamRange copies n bytes at the offset off from src to dst through a buffer,
+// a negative n copies until the end of src.
+func streamRange(ctx context.Context, dst, src *os.File, off, n int64, progress func(n int64)) (int64, error) {
+	var written int64
+	for n < 0 || written < n {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		chunk := int64(copyChunkSize)
+		if n >= 0 {
+			chunk = min(n-written, chunk)
+		}
+		w := io.NewOffsetWriter(dst, off+written)
+		c, err := io.Copy(w, io.NewSectionReader(src, off+written, chunk))
+		if c > 0 {
+			written += c
+			progress(c)
+		}
+		if err != nil {
+			return written, err
+		}
+		// the end of src
+		if c < chunk {
+			break
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,165 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyContents copies size bytes from src to dst with the given CopyMethod,
+// CopyMethodAuto tries the methods from the fastest to the slowest.
+func copyContents(ctx context.Context, dst, src *os.File, size int64, method CopyMethod, progress func(n int64)) error {
+	if method != CopyMethodAuto {
+		return copyContentsWith(ctx, dst, src, size, method, progress)
+	}
+	for _, m := range []CopyMethod{CopyMethodReflink, CopyMethodCopyFileRange, CopyMethodSendfile} {
+		err := copyContentsWith(ctx, dst, src, size, m, progress)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+	return copyContentsWith(ctx, dst, src, size, CopyMethodStream, progress)
+}
+
+func copyContentsWith(ctx context.Context, dst, src *os.File, size int64, method CopyMethod, progress func(n int64)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	switch method {
+	case CopyMethodReflink:
+		if err := unix.IoctlFileClone(int(dst.Fd()), int(src.Fd())); err != nil {
+			if isUnsupported(err) {
+				return unsupportedMethod(method, err)
+			}
+			return err
+		}
+		progress(size)
+		return nil
+	case CopyMethodCopyFileRange, CopyMethodSendfile, CopyMethodStream:
+	default:
+		return unsupportedMethod(method, nil)
+	}
+
+	var written int64
+	// only copies the data segments, so that the holes of sparse files are kept
+	trailingHole, err := forEachDataSegment(src, size, func(off, n int64) error {
+		c, err := copyRange(ctx, dst, src, off, n, method, progress)
+		written += c
+		if err != nil && written == 0 && isUnsupported(err) {
+			return unsupportedMethod(method, err)
+		}
+		return err
+	})
+	if err != nil || !trailingHole {
+		return err
+	}
+	// extends dst to the size of src, including the trailing hole
+	return dst.Truncate(size)
+}
+
+// forEachDataSegment calls fn with the offset and length of each data segment of
+// the given file, the last segment has a negative length, so that it is copied
+// until the end of the file even if its size is wrong, like the files of /proc.
+// It reports whether the file ends with a hole.
+func forEachDataSegment(f *os.File, size int64, fn func(off, n int64) error) (bool, error) {
+	if size == 0 {
+		return false, fn(0, -1)
+	}
+	fd := int(f.Fd())
+	var off int64
+	for {
+		data, err := unix.Seek(fd, off, unix.SEEK_DATA)
+		if err != nil {
+			// no more data after off
+			if errors.Is(err, unix.ENXIO) {
+				return true, nil
+			}
+			if off == 0 && isUnsupported(err) {
+				return false, fn(0, -1)
+			}
+			return false, err
+		}
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return false, err
+		}
+		if hole >= size {
+			return false, fn(data, -1)
+		}
+		if err = fn(data, hole-data); err != nil {
+			return false, err
+		}
+		off = hole
+	}
+}
+
+// copyRange copies n bytes at the offset off from src to dst with the given method,
+// a negative n copies until the end of src. It returns the number of bytes copied.
+func copyRange(ctx context.Context, dst, src *os.File, off, n int64, method CopyMethod, progress func(n int64)) (int64, error) {
+	if method == CopyMethodStream {
+		return streamRange(ctx, dst, src, off, n, progress)
+	}
+	var written int64
+	for n < 0 || written < n {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		chunk := copyChunkSize
+		if n >= 0 {
+			chunk = int(min(n-written, copyChunkSize))
+		}
+		roff := off + written
+		var (
+			c   int
+			err error
+		)
+		if method == CopyMethodCopyFileRange {
+			woff := roff
+			c, err = unix.CopyFileRange(int(src.Fd()), &roff, int(dst.Fd()), &woff, chunk, 0)
+		} else {
+			// sendfile writes at the current offset of dst
+			if _, err = dst.Seek(roff, io.SeekStart); err != nil {
+				return written, err
+			}
+			c, err = unix.Sendfile(int(dst.Fd()), int(src.Fd()), &roff, chunk)
+		}
+		if c > 0 {
+			written += int64(c)
+			progress(int64(c))
+		}
+		if err != nil {
+			if errors.Is(err, unix.EINTR) || errors.Is(err, unix.EAGAIN) {
+				continue
+			}
+			return written, err
+		}
+		if c == 0 {
+			// some virtual and FUSE file systems copy nothing instead of failing,
+			// CopyMethodAuto falls back to the next method.
+			if written == 0 && !atEOF(src, roff) {
+				return 0, unsupportedMethod(method, nil)
+			}
+			// the end of src
+			break
+		}
+	}
+	return written, nil
+}
+
+// atEOF reports whether there is nothing to read at the offset off of f.
+func atEOF(f *os.File, off int64) bool {
+	_, err := f.ReadAt(make([]byte, 1), off)
+	return errors.Is(err, io.EOF)
+}
+
+func isUnsupported(err error) bool {
+	for _, errno := range []unix.Errno{unix.ENOSYS, unix.EOPNOTSUPP, unix.ENOTSUP, unix.EXDEV, unix.EINVAL, unix.ENOTTY, unix.EBADF} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
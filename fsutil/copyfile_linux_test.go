@@ -0,0 +1,107 @@
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyFileSparse(t *testing.T) {
+	const size = 8 << 20
+	src := filepath.Join(t.TempDir(), "sparse")
+	f, err := os.Create(src)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Truncate(size))
+	data := bytes.Repeat([]byte("data"), 1024)
+	_, err = f.WriteAt(data, 4<<20)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	want, err := os.ReadFile(src)
+	assert.NoError(t, err)
+
+	for _, method := range []CopyMethod{
+		CopyMethodAuto,
+		CopyMethodReflink,
+		CopyMethodCopyFileRange,
+		CopyMethodSendfile,
+		CopyMethodStream,
+	} {
+		t.Run(method.String(), func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "sparse")
+			err := CopyFileWithMethod(src, dst, method)
+			if errors.Is(err, errors.ErrUnsupported) {
+				t.Skipf("%s is not supported: %s", method, err)
+			}
+			assert.NoError(t, err)
+			got, err := os.ReadFile(dst)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(want, got))
+
+			info, err := os.Stat(dst)
+			assert.NoError(t, err)
+			stat := info.Sys().(*syscall.Stat_t)
+			assert.True(t, stat.Blocks*512 < size, "%d blocks allocated", stat.Blocks)
+		})
+	}
+}
+
+func TestCopyFileWrongSize(t *testing.T) {
+	for _, src := range []string{
+		// reports a size of zero
+		"/proc/version",
+		// reports a size of a page
+		"/sys/kernel/mm/transparent_hugepage/enabled",
+	} {
+		want, err := os.ReadFile(src)
+		if err != nil {
+			t.Logf("skip %s: %s", src, err)
+			continue
+		}
+		for _, method := range []CopyMethod{
+			CopyMethodAuto,
+			CopyMethodCopyFileRange,
+			CopyMethodSendfile,
+			CopyMethodStream,
+		} {
+			dst := filepath.Join(t.TempDir(), "copy")
+			err := CopyFileWithMethod(src, dst, method)
+			if errors.Is(err, errors.ErrUnsupported) {
+				continue
+			}
+			assert.NoError(t, err, "%s %s", src, method)
+			got, err := os.ReadFile(dst)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, got, "%s %s", src, method)
+			assert.Equal(t, string(want), string(got), "%s %s", src, method)
+		}
+	}
+}
+
+func TestCopyFileEmpty(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "empty")
+	assert.NoError(t, os.WriteFile(src, nil, 0o644))
+	assert.True(t, atEOF(mustOpen(t, src), 0))
+	assert.False(t, atEOF(mustOpen(t, "/proc/version"), 0))
+
+	// copying nothing is not mistaken for an unsupported method
+	for _, method := range []CopyMethod{CopyMethodCopyFileRange, CopyMethodSendfile} {
+		dst := filepath.Join(t.TempDir(), "copy")
+		assert.NoError(t, CopyFileWithMethod(src, dst, method), method.String())
+		info, err := os.Stat(dst)
+		assert.NoError(t, err)
+		assert.Zero(t, info.Size())
+	}
+}
+
+func mustOpen(t *testing.T, fpath string) *os.File {
+	t.Helper()
+	fd, err := os.Open(fpath)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = fd.Close() })
+	return fd
+}
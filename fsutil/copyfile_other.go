@@ -0,0 +1,17 @@
+//go:build !linux
+
+package fsutil
+
+import (
+	"context"
+	"os"
+)
+
+// copyContents only supports CopyMethodStream on platforms other than Linux.
+func copyContents(ctx context.Context, dst, src *os.File, _ int64, method CopyMethod, progress func(n int64)) error {
+	if method != CopyMethodAuto && method != CopyMethodStream {
+		return unsupportedMethod(method, nil)
+	}
+	_, err := streamRange(ctx, dst, src, 0, -1, progress)
+	return err
+}
@@ -0,0 +1,31 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyFileWithMethod(t *testing.T) {
+	want, err := os.ReadFile("testdata/src/a.txt")
+	assert.NoError(t, err)
+
+	t.Run("stream", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "a.txt")
+		err := CopyFileWithMethod("testdata/src/a.txt", dst, CopyMethodStream)
+		assert.NoError(t, err)
+		got, err := os.ReadFile(dst)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "a.txt")
+		err := CopyFileWithMethod("testdata/src/a.txt", dst, CopyMethod(100))
+		assert.True(t, errors.Is(err, errors.ErrUnsupported))
+		assert.Equal(t, "unknown copy method: 100", CopyMethod(100).String())
+	})
+}
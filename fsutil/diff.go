@@ -0,0 +1,245 @@
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DiffKind is the kind of change of a DiffEntry.
+type DiffKind int
+
+const (
+	// DiffAdded is an entry that only exists in the second tree.
+	DiffAdded DiffKind = iota
+	// DiffRemoved is an entry that only exists in the first tree.
+	DiffRemoved
+	// DiffModified is an entry whose type, content or symlink target changed.
+	DiffModified
+	// DiffModeChanged is an entry whose permission bits changed.
+	DiffModeChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffModified:
+		return "modified"
+	case DiffModeChanged:
+		return "mode changed"
+	default:
+		return fmt.Sprintf("unknown diff kind: %d", int(k))
+	}
+}
+
+// symbol returns the symbol of the kind used by TreeDiff.String.
+func (k DiffKind) symbol() string {
+	switch k {
+	case DiffAdded:
+		return "+"
+	case DiffRemoved:
+		return "-"
+	case DiffModified:
+		return "M"
+	default:
+		return "m"
+	}
+}
+
+// DiffEntry is a change between two trees.
+type DiffEntry struct {
+	// Path is the slash-separated path relative to the roots.
+	Path string
+	Kind DiffKind
+	// A is the info of the entry in the first tree, nil if it is added.
+	A fs.FileInfo
+	// B is the info of the entry in the second tree, nil if it is removed.
+	B fs.FileInfo
+}
+
+// DiffOptions configures DiffTrees.
+type DiffOptions struct {
+	// Hash returns the checksum of a file, such as xsha256.EncryptFile of the
+	// cryptoutil package. If it is set, the files of the same size are compared
+	// by their checksum instead of their modification time.
+	Hash func(fpath string) (string, error)
+	// IgnoreTimes compares the files by their size only, it is ignored if Hash is set.
+	IgnoreTimes bool
+	// Exclude is a list of glob patterns like CopyOptions.Exclude, the matching
+	// entries are not compared.
+	Exclude []string
+}
+
+// TreeDiff is the result of DiffTrees, the entries are sorted by path.
+type TreeDiff struct {
+	Entries []DiffEntry
+}
+
+// Filter returns the entries of the given kind.
+func (d *TreeDiff) Filter(kind DiffKind) []DiffEntry {
+	var entries []DiffEntry
+	for _, entry := range d.Entries {
+		if entry.Kind == kind {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Empty reports whether the trees are the same.
+func (d *TreeDiff) Empty() bool {
+	return len(d.Entries) == 0
+}
+
+// String returns a summary of the diff, one line per entry prefixed by
+// "+" (added), "-" (removed), "M" (modified) or "m" (mode changed),
+// followed by the number of entries of each kind.
+func (d *TreeDiff) String() string {
+	var (
+		b      strings.Builder
+		counts [DiffModeChanged + 1]int
+	)
+	for _, entry := range d.Entries {
+		counts[entry.Kind]++
+		b.WriteString(entry.Kind.symbol())
+		b.WriteString(" ")
+		b.WriteString(entry.Path)
+		if entry.Kind == DiffModeChanged {
+			fmt.Fprintf(&b, " (%s -> %s)", entry.A.Mode().Perm(), entry.B.Mode().Perm())
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%d added, %d removed, %d modified, %d mode changed",
+		counts[DiffAdded], counts[DiffRemoved], counts[DiffModified], counts[DiffModeChanged])
+	return b.String()
+}
+
+// DiffTrees compares the directory trees a and b. Symlinks are compared by their
+// targets, directories by their permission bits only.
+func DiffTrees(a, b string, opts DiffOptions) (*TreeDiff, error) {
+	for _, pattern := range opts.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	ainfos, err := listInfos(a, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	binfos, err := listInfos(b, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(ainfos)+len(binfos))
+	for rel := range ainfos {
+		paths = append(paths, rel)
+	}
+	for rel := range binfos {
+		if _, ok := ainfos[rel]; !ok {
+			paths = append(paths, rel)
+		}
+	}
+	sort.Strings(paths)
+
+	diff := &TreeDiff{}
+	for _, rel := range paths {
+		ainfo, aok := ainfos[rel]
+		binfo, bok := binfos[rel]
+		switch {
+		case !aok:
+			diff.Entries = append(diff.Entries, DiffEntry{Path: rel, Kind: DiffAdded, B: binfo})
+			continue
+		case !bok:
+			diff.Entries = append(diff.Entries, DiffEntry{Path: rel, Kind: DiffRemoved, A: ainfo})
+			continue
+		}
+		modified, err := diffEntry(filepath.Join(a, filepath.FromSlash(rel)), filepath.Join(b, filepath.FromSlash(rel)), ainfo, binfo, opts)
+		if err != nil {
+			return nil, err
+		}
+		if modified {
+			diff.Entries = append(diff.Entries, DiffEntry{Path: rel, Kind: DiffModified, A: ainfo, B: binfo})
+		}
+		if ainfo.Mode()&fs.ModeSymlink == 0 && ainfo.Mode().Type() == binfo.Mode().Type() &&
+			ainfo.Mode().Perm() != binfo.Mode().Perm() {
+			diff.Entries = append(diff.Entries, DiffEntry{Path: rel, Kind: DiffModeChanged, A: ainfo, B: binfo})
+		}
+	}
+	return diff, nil
+}
+
+// diffEntry reports whether the entry is modified.
+func diffEntry(apath, bpath string, ainfo, binfo fs.FileInfo, opts DiffOptions) (bool, error) {
+	if ainfo.Mode().Type() != binfo.Mode().Type() {
+		return true, nil
+	}
+	switch {
+	case ainfo.Mode()&fs.ModeSymlink != 0:
+		atarget, err := os.Readlink(apath)
+		if err != nil {
+			return false, err
+		}
+		btarget, err := os.Readlink(bpath)
+		if err != nil {
+			return false, err
+		}
+		return atarget != btarget, nil
+	case ainfo.Mode().IsRegular():
+		if ainfo.Size() != binfo.Size() {
+			return true, nil
+		}
+		if opts.Hash != nil {
+			asum, err := opts.Hash(apath)
+			if err != nil {
+				return false, err
+			}
+			bsum, err := opts.Hash(bpath)
+			if err != nil {
+				return false, err
+			}
+			return asum != bsum, nil
+		}
+		return !opts.IgnoreTimes && !ainfo.ModTime().Equal(binfo.ModTime()), nil
+	default:
+		return false, nil
+	}
+}
+
+// listInfos returns the info of each entry under root by its slash-separated relative path.
+func listInfos(root string, exclude []string) (map[string]fs.FileInfo, error) {
+	infos := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(root, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if fpath == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, fpath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if matchAny(exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos[rel] = info
+		return nil
+	})
+	return infos, err
+}
@@ -0,0 +1,104 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shipengqi/golib/cryptoutil/xsha256"
+)
+
+func TestDiffTrees(t *testing.T) {
+	t.Run("same trees", func(t *testing.T) {
+		a := newCopyTree(t)
+		b := filepath.Join(t.TempDir(), "b")
+		assert.NoError(t, CopyWithOptions(a, b, CopyOptions{KeepSymlinks: true, PreserveTimes: true}))
+
+		diff, err := DiffTrees(a, b, DiffOptions{})
+		assert.NoError(t, err)
+		assert.True(t, diff.Empty())
+		assert.Equal(t, "0 added, 0 removed, 0 modified, 0 mode changed", diff.String())
+	})
+
+	t.Run("changed trees", func(t *testing.T) {
+		a := newCopyTree(t)
+		b := filepath.Join(t.TempDir(), "b")
+		assert.NoError(t, CopyWithOptions(a, b, CopyOptions{KeepSymlinks: true, PreserveTimes: true}))
+
+		assert.NoError(t, os.WriteFile(filepath.Join(b, "a.txt"), []byte("changed"), 0o644))
+		assert.NoError(t, os.Chmod(filepath.Join(b, "b.log"), 0o600))
+		assert.NoError(t, os.Remove(filepath.Join(b, "link")))
+		assert.NoError(t, os.Symlink("b.log", filepath.Join(b, "link")))
+		assert.NoError(t, os.RemoveAll(filepath.Join(b, "vendor")))
+		assert.NoError(t, os.WriteFile(filepath.Join(b, "sub", "new.txt"), []byte("new"), 0o644))
+		// a file replaced by a directory
+		assert.NoError(t, os.RemoveAll(filepath.Join(b, "sub", "d.log")))
+		assert.NoError(t, os.Mkdir(filepath.Join(b, "sub", "d.log"), 0o755))
+
+		diff, err := DiffTrees(a, b, DiffOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, `M a.txt
+m b.log (-rw-r--r-- -> -rw-------)
+M link
+M sub/d.log
++ sub/new.txt
+- vendor
+- vendor/e.txt
+1 added, 2 removed, 3 modified, 1 mode changed`, diff.String())
+		assert.Len(t, diff.Filter(DiffModified), 3)
+		assert.Len(t, diff.Filter(DiffModeChanged), 1)
+	})
+
+	t.Run("compare by hash", func(t *testing.T) {
+		a := newCopyTree(t)
+		b := filepath.Join(t.TempDir(), "b")
+		assert.NoError(t, CopyWithOptions(a, b, CopyOptions{KeepSymlinks: true, PreserveTimes: true}))
+		later := time.Now().Add(time.Hour)
+		assert.NoError(t, os.Chtimes(filepath.Join(b, "a.txt"), later, later))
+		// same size and modification time, different content
+		info, err := os.Stat(filepath.Join(b, "b.log"))
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(b, "b.log"), []byte("x"), 0o644))
+		assert.NoError(t, os.Chtimes(filepath.Join(b, "b.log"), info.ModTime(), info.ModTime()))
+
+		diff, err := DiffTrees(a, b, DiffOptions{IgnoreTimes: true})
+		assert.NoError(t, err)
+		assert.True(t, diff.Empty())
+
+		diff, err = DiffTrees(a, b, DiffOptions{Hash: xsha256.EncryptFile})
+		assert.NoError(t, err)
+		assert.Equal(t, []DiffEntry{{Path: "b.log", Kind: DiffModified}}, stripInfos(diff.Entries))
+
+		// b.log is missed when comparing by size and modification time
+		diff, err = DiffTrees(a, b, DiffOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []DiffEntry{{Path: "a.txt", Kind: DiffModified}}, stripInfos(diff.Entries))
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		a := newCopyTree(t)
+		b := t.TempDir()
+		diff, err := DiffTrees(a, b, DiffOptions{Exclude: []string{"*.log", "vendor", "sub"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []DiffEntry{
+			{Path: "a.txt", Kind: DiffRemoved},
+			{Path: "link", Kind: DiffRemoved},
+		}, stripInfos(diff.Entries))
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := DiffTrees(t.TempDir(), t.TempDir(), DiffOptions{Exclude: []string{"["}})
+		assert.Error(t, err)
+	})
+}
+
+func stripInfos(entries []DiffEntry) []DiffEntry {
+	stripped := make([]DiffEntry, 0, len(entries))
+	for _, entry := range entries {
+		stripped = append(stripped, DiffEntry{Path: entry.Path, Kind: entry.Kind})
+	}
+	return stripped
+}
@@ -0,0 +1,220 @@
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EntryType is a set of entry types used by FindOptions.
+type EntryType uint8
+
+const (
+	// EntryFile is a regular file.
+	EntryFile EntryType = 1 << iota
+	// EntryDir is a directory.
+	EntryDir
+	// EntrySymlink is a symbolic link, the links are not followed.
+	EntrySymlink
+	// EntryOther is a device, named pipe or socket.
+	EntryOther
+)
+
+func entryType(mode fs.FileMode) EntryType {
+	switch {
+	case mode.IsRegular():
+		return EntryFile
+	case mode.IsDir():
+		return EntryDir
+	case mode&fs.ModeSymlink != 0:
+		return EntrySymlink
+	default:
+		return EntryOther
+	}
+}
+
+// FindOptions configures Find, the zero value finds every entry under the root.
+type FindOptions struct {
+	// Patterns is a list of patterns with the syntax of MatchGlob, if it is not empty,
+	// only the entries whose slash-separated path relative to the root matches one
+	// of them are found. Use "**/*.go" to find the Go files at any depth.
+	Patterns []string
+	// Exclude is a list of patterns with the syntax of .gitignore, relative to the root.
+	// The excluded directories are not walked.
+	Exclude []string
+	// ExcludeFrom is a list of files such as .dockerignore, that hold patterns relative
+	// to the root, a pattern without a slash only matches at the root.
+	ExcludeFrom []string
+	// IgnoreFiles is a list of file names such as .gitignore, that are read in each
+	// walked directory, and apply to the directory like git does.
+	IgnoreFiles []string
+	// Type is a set of entry types to find, zero finds all types.
+	Type EntryType
+	// MinSize only finds the regular files of at least MinSize bytes.
+	MinSize int64
+	// MaxSize only finds the regular files of at most MaxSize bytes, zero means no limit.
+	MaxSize int64
+	// NewerThan only finds the entries modified after the given time.
+	NewerThan time.Time
+	// OlderThan only finds the entries modified before the given time.
+	OlderThan time.Time
+	// Perm only finds the entries that have all the given permission bits.
+	Perm fs.FileMode
+	// MaxDepth is the maximum depth of the entries, the children of the root are
+	// at depth 1. Zero means no limit.
+	MaxDepth int
+}
+
+// Find returns the paths of the entries under root that match the options, in
+// lexical order, a directory before its children. The root itself is not found.
+func Find(root string, opts FindOptions) ([]string, error) {
+	var found []string
+	for fpath, err := range FindSeq(root, opts) {
+		if err != nil {
+			return found, err
+		}
+		found = append(found, fpath)
+	}
+	return found, nil
+}
+
+// FindSeq is like Find but yields the paths as the tree is walked. An error is
+// yielded with the path where it happened, the walk continues unless the loop stops.
+func FindSeq(root string, opts FindOptions) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		f, err := newFinder(opts)
+		if err != nil {
+			yield(root, err)
+			return
+		}
+		info, err := os.Lstat(root)
+		if err != nil {
+			yield(root, err)
+			return
+		}
+		if !info.IsDir() {
+			yield(root, &fs.PathError{Op: "find", Path: root, Err: errors.New("not a directory")})
+			return
+		}
+		f.walk(root, "", f.rules, yield)
+	}
+}
+
+type finder struct {
+	opts  FindOptions
+	rules []ignoreRule
+}
+
+func newFinder(opts FindOptions) (*finder, error) {
+	for _, pattern := range opts.Patterns {
+		if err := validGlob(pattern); err != nil {
+			return nil, err
+		}
+	}
+	f := &finder{opts: opts}
+	for _, line := range opts.Exclude {
+		rule, ok, err := parseIgnoreRule(line, "", true)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			f.rules = append(f.rules, rule)
+		}
+	}
+	for _, fpath := range opts.ExcludeFrom {
+		rules, err := readIgnoreFile(fpath, "", false)
+		if err != nil {
+			return nil, err
+		}
+		f.rules = append(f.rules, rules...)
+	}
+	return f, nil
+}
+
+// walk walks the directory dir, rel is its slash-separated path relative to the
+// root, rules are the exclude rules followed by the rules of the ignore files of its parents.
+func (f *finder) walk(dir, rel string, rules []ignoreRule, yield func(string, error) bool) bool {
+	for _, name := range f.opts.IgnoreFiles {
+		more, err := readIgnoreFile(filepath.Join(dir, name), rel, true)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			if !yield(filepath.Join(dir, name), err) {
+				return false
+			}
+			continue
+		}
+		// the slice is cloned, so that the siblings do not share the rules
+		rules = append(rules[:len(rules):len(rules)], more...)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return yield(dir, err)
+	}
+	for _, entry := range entries {
+		fpath := filepath.Join(dir, entry.Name())
+		erel := path.Join(rel, entry.Name())
+		if ignored(rules, erel, entry.IsDir()) {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed after it was listed
+			continue
+		}
+		if err != nil {
+			if !yield(fpath, err) {
+				return false
+			}
+			continue
+		}
+		if f.match(erel, info) && !yield(fpath, nil) {
+			return false
+		}
+		if entry.IsDir() && (f.opts.MaxDepth <= 0 || strings.Count(erel, "/")+1 < f.opts.MaxDepth) {
+			if !f.walk(fpath, erel, rules, yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (f *finder) match(rel string, info fs.FileInfo) bool {
+	opts := f.opts
+	typ := entryType(info.Mode())
+	if opts.Type != 0 && opts.Type&typ == 0 {
+		return false
+	}
+	if opts.MinSize > 0 || opts.MaxSize > 0 {
+		if typ != EntryFile || info.Size() < opts.MinSize || (opts.MaxSize > 0 && info.Size() > opts.MaxSize) {
+			return false
+		}
+	}
+	if !opts.NewerThan.IsZero() && !info.ModTime().After(opts.NewerThan) {
+		return false
+	}
+	if !opts.OlderThan.IsZero() && !info.ModTime().Before(opts.OlderThan) {
+		return false
+	}
+	if info.Mode().Perm()&opts.Perm != opts.Perm {
+		return false
+	}
+	if len(opts.Patterns) == 0 {
+		return true
+	}
+	name := strings.Split(rel, "/")
+	for _, pattern := range opts.Patterns {
+		if matchSegments(strings.Split(pattern, "/"), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFindTree creates the tree:
+//
+//	.gitignore       *.log, !keep.log
+//	README.md
+//	main.go
+//	app.log
+//	keep.log
+//	cmd/tool/main.go
+//	cmd/tool/.gitignore  /generated.go
+//	cmd/tool/generated.go
+//	vendor/lib/lib.go
+func newFindTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		".gitignore":            "*.log\n!keep.log\n",
+		"README.md":             "readme",
+		"main.go":               "package main",
+		"app.log":               "log",
+		"keep.log":              "keep",
+		"cmd/tool/main.go":      "package main\n\nfunc main() {}",
+		"cmd/tool/.gitignore":   "/generated.go\n",
+		"cmd/tool/generated.go": "package main",
+		"vendor/lib/lib.go":     "package lib",
+	} {
+		fp := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fp), 0o755))
+		assert.NoError(t, os.WriteFile(fp, []byte(content), 0o644))
+	}
+	return root
+}
+
+func findRel(t *testing.T, root string, opts FindOptions) []string {
+	t.Helper()
+	found, err := Find(root, opts)
+	assert.NoError(t, err)
+	rels := make([]string, 0, len(found))
+	for _, fpath := range found {
+		rel, err := filepath.Rel(root, fpath)
+		assert.NoError(t, err)
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	return rels
+}
+
+func TestFind(t *testing.T) {
+	root := newFindTree(t)
+
+	t.Run("all", func(t *testing.T) {
+		assert.Equal(t, []string{
+			".gitignore", "README.md", "app.log", "cmd", "cmd/tool", "cmd/tool/.gitignore",
+			"cmd/tool/generated.go", "cmd/tool/main.go", "keep.log", "main.go",
+			"vendor", "vendor/lib", "vendor/lib/lib.go",
+		}, findRel(t, root, FindOptions{}))
+	})
+
+	t.Run("patterns", func(t *testing.T) {
+		assert.Equal(t, []string{"main.go"}, findRel(t, root, FindOptions{Patterns: []string{"*.go"}}))
+		assert.Equal(t, []string{"cmd/tool/generated.go", "cmd/tool/main.go", "main.go", "vendor/lib/lib.go"},
+			findRel(t, root, FindOptions{Patterns: []string{"**/*.go"}}))
+		assert.Equal(t, []string{"cmd/tool", "cmd/tool/.gitignore", "cmd/tool/generated.go", "cmd/tool/main.go"},
+			findRel(t, root, FindOptions{Patterns: []string{"cmd/**"}, Type: EntryFile | EntryDir}))
+	})
+
+	t.Run("ignore files", func(t *testing.T) {
+		assert.Equal(t, []string{"cmd/tool/main.go", "keep.log", "main.go"}, findRel(t, root, FindOptions{
+			Type:        EntryFile,
+			Exclude:     []string{"vendor/", ".gitignore", "*.md"},
+			IgnoreFiles: []string{".gitignore"},
+		}))
+
+		dockerignore := filepath.Join(t.TempDir(), ".dockerignore")
+		assert.NoError(t, os.WriteFile(dockerignore, []byte("# comment\nvendor\n*.log\n**/*.go\n!cmd/tool/main.go\n"), 0o644))
+		assert.Equal(t, []string{".gitignore", "README.md", "cmd", "cmd/tool", "cmd/tool/.gitignore", "cmd/tool/main.go"},
+			findRel(t, root, FindOptions{ExcludeFrom: []string{dockerignore}}))
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		assert.Equal(t, []string{"cmd", "vendor"}, findRel(t, root, FindOptions{MaxDepth: 1, Type: EntryDir}))
+		assert.Equal(t, []string{"cmd/tool/main.go"}, findRel(t, root, FindOptions{MinSize: 20}))
+		assert.Equal(t, []string{"app.log"}, findRel(t, root, FindOptions{MaxSize: 3}))
+
+		old := time.Now().Add(-time.Hour)
+		assert.NoError(t, os.Chtimes(filepath.Join(root, "README.md"), old, old))
+		assert.Equal(t, []string{"README.md"}, findRel(t, root, FindOptions{
+			Type:      EntryFile,
+			OlderThan: time.Now().Add(-time.Minute),
+		}))
+		assert.NotContains(t, findRel(t, root, FindOptions{NewerThan: time.Now().Add(-time.Minute)}), "README.md")
+
+		if runtime.GOOS == "windows" {
+			return
+		}
+		assert.NoError(t, os.Chmod(filepath.Join(root, "main.go"), 0o755))
+		assert.Equal(t, []string{"main.go"}, findRel(t, root, FindOptions{Type: EntryFile, Perm: 0o100}))
+		assert.NoError(t, os.Symlink("main.go", filepath.Join(root, "link")))
+		assert.Equal(t, []string{"link"}, findRel(t, root, FindOptions{Type: EntrySymlink}))
+	})
+
+	t.Run("seq", func(t *testing.T) {
+		var found []string
+		for fpath, err := range FindSeq(root, FindOptions{Patterns: []string{"**/*.go"}}) {
+			assert.NoError(t, err)
+			found = append(found, fpath)
+			if len(found) == 2 {
+				break
+			}
+		}
+		assert.Len(t, found, 2)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := Find(root, FindOptions{Patterns: []string{"["}})
+		assert.Error(t, err)
+		_, err = Find(root, FindOptions{Exclude: []string{"a/["}})
+		assert.Error(t, err)
+		_, err = Find(filepath.Join(root, "missing"), FindOptions{})
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+		_, err = Find(filepath.Join(root, "main.go"), FindOptions{})
+		assert.Error(t, err)
+	})
+}
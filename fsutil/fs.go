@@ -1,8 +1,7 @@
 package fsutil
 
 import (
-	"bufio"
-	"io"
+	"context"
 	"os"
 	"path/filepath"
 )
@@ -10,28 +9,16 @@ import (
 type WalkFunc func(line []byte) error
 
 // CopyFile copies a file from src to dst.
-func CopyFile(src, dst string) (err error) {
-	sfd, err := os.Open(src)
-	if err != nil {
-		return
-	}
-	defer func() { _ = sfd.Close() }()
-
-	dfd, err := os.OpenFile(dst,
-		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return
-	}
-	defer func() { _ = dfd.Close() }()
+// On Linux, it tries reflink, copy_file_range and sendfile before streaming
+// the content, and keeps sparse files sparse.
+func CopyFile(src, dst string) error {
+	return copyFile(context.Background(), src, dst, CopyMethodAuto, nil)
+}
 
-	if _, err = io.Copy(dfd, sfd); err != nil {
-		return err
-	}
-	info, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-	return os.Chmod(dst, info.Mode())
+// CopyFileWithMethod is like CopyFile but only uses the given CopyMethod, it returns
+// an error that matches errors.ErrUnsupported if the method is not supported.
+func CopyFileWithMethod(src, dst string, method CopyMethod) error {
+	return copyFile(context.Background(), src, dst, method, nil)
 }
 
 // Copy copies a file or directory from src to dst.
@@ -94,25 +81,12 @@ func MkDirAll(fpath string) error {
 }
 
 // Walk walks the line of the given file, calling fn for each line.
+// See WalkLines for more options.
 func Walk(fpath string, fn WalkFunc) error {
 	if IsDir(fpath) {
 		return nil
 	}
-	fd, err := os.Open(fpath)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = fd.Close() }()
-	s := bufio.NewScanner(fd)
-	for s.Scan() {
-		err = fn(s.Bytes())
-		if err != nil {
-			return err
-		}
-	}
-	if err = s.Err(); err != nil {
-		return err
-	}
-
-	return nil
+	return WalkLines(context.Background(), fpath, WalkOptions{}, func(_ int, line []byte) error {
+		return fn(line)
+	})
 }
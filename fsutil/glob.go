@@ -0,0 +1,145 @@
+package fsutil
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether the slash-separated name matches the pattern. The
+// pattern has the syntax of path.Match, and a "**" segment matches zero or more
+// path segments, except at the end of the pattern where it matches one or more
+// segments, so that "a/**" matches the content of a but not a itself.
+func MatchGlob(pattern, name string) (bool, error) {
+	if err := validGlob(pattern); err != nil {
+		return false, err
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/")), nil
+}
+
+func validGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 1 && pattern[1] == "**" {
+				pattern = pattern[1:]
+			}
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignoreRule is a line of an ignore file.
+type ignoreRule struct {
+	// base is the directory of the ignore file relative to the root, "" for the root.
+	base    string
+	pattern []string
+	negate  bool
+	dirOnly bool
+}
+
+// parseIgnoreRule parses a line of an ignore file. A pattern without a slash
+// matches at any depth if unanchored is set like .gitignore, otherwise the
+// patterns are relative to base like .dockerignore.
+func parseIgnoreRule(line, base string, unanchored bool) (ignoreRule, bool, error) {
+	rule := ignoreRule{base: base}
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if unanchored && !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	line = path.Clean("/" + line)[1:]
+	if line == "" {
+		return rule, false, nil
+	}
+	if err := validGlob(line); err != nil {
+		return rule, false, err
+	}
+	rule.pattern = strings.Split(line, "/")
+	return rule, true, nil
+}
+
+// match reports whether the rule matches the slash-separated path relative to the root.
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	return matchSegments(r.pattern, strings.Split(rel, "/"))
+}
+
+// readIgnoreFile reads the rules of an ignore file.
+func readIgnoreFile(fpath, base string, unanchored bool) ([]ignoreRule, error) {
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = fd.Close() }()
+	var rules []ignoreRule
+	s := bufio.NewScanner(fd)
+	for s.Scan() {
+		rule, ok, err := parseIgnoreRule(s.Text(), base, unanchored)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fpath, err)
+		}
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, s.Err()
+}
+
+// ignored reports whether the last matching rule excludes the path.
+func ignored(rules []ignoreRule, rel string, isDir bool) bool {
+	excluded := false
+	for _, rule := range rules {
+		if rule.match(rel, isDir) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
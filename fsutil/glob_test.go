@@ -0,0 +1,80 @@
+package fsutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"*.go", "a.go", true},
+		{"*.go", "sub/a.go", false},
+		{"**/*.go", "a.go", true},
+		{"**/*.go", "sub/deep/a.go", true},
+		{"sub/**/*.go", "sub/a.go", true},
+		{"sub/**/*.go", "sub/x/y/a.go", true},
+		{"sub/**/*.go", "other/a.go", false},
+		{"sub/**", "sub", false},
+		{"sub/**", "sub/a", true},
+		{"sub/**", "sub/a/b", true},
+		{"**", "a/b", true},
+		{"a/**/**/b", "a/b", true},
+		{"a/?/c", "a/b/c", true},
+		{"a/[bc]/d", "a/d/d", false},
+	}
+	for _, v := range tests {
+		ok, err := MatchGlob(v.pattern, v.name)
+		assert.NoError(t, err)
+		assert.Equal(t, v.expected, ok, "%s %s", v.pattern, v.name)
+	}
+
+	_, err := MatchGlob("a/[", "a/b")
+	assert.Error(t, err)
+}
+
+func TestIgnoreRules(t *testing.T) {
+	parse := func(base string, unanchored bool, lines ...string) []ignoreRule {
+		var rules []ignoreRule
+		for _, line := range lines {
+			rule, ok, err := parseIgnoreRule(line, base, unanchored)
+			assert.NoError(t, err)
+			if ok {
+				rules = append(rules, rule)
+			}
+		}
+		return rules
+	}
+
+	rules := parse("", true, "# comment", "", "*.log", "!keep.log", "build/", "/root.txt", `\#hash`)
+	assert.Len(t, rules, 5)
+	assert.True(t, ignored(rules, "a.log", false))
+	assert.True(t, ignored(rules, "sub/a.log", false))
+	assert.False(t, ignored(rules, "sub/keep.log", false))
+	assert.True(t, ignored(rules, "sub/build", true))
+	assert.False(t, ignored(rules, "sub/build", false))
+	assert.True(t, ignored(rules, "root.txt", false))
+	assert.False(t, ignored(rules, "sub/root.txt", false))
+	assert.True(t, ignored(rules, "#hash", false))
+
+	// the rules of a nested ignore file apply to its directory
+	rules = parse("sub", true, "*.tmp", "/only.txt")
+	assert.True(t, ignored(rules, "sub/deep/a.tmp", false))
+	assert.False(t, ignored(rules, "a.tmp", false))
+	assert.True(t, ignored(rules, "sub/only.txt", false))
+	assert.False(t, ignored(rules, "sub/deep/only.txt", false))
+
+	// like .dockerignore
+	rules = parse("", false, "*.md", "**/*.tmp", "!README.md")
+	assert.True(t, ignored(rules, "a.md", false))
+	assert.False(t, ignored(rules, "docs/a.md", false))
+	assert.False(t, ignored(rules, "README.md", false))
+	assert.True(t, ignored(rules, "docs/a.tmp", false))
+
+	_, _, err := parseIgnoreRule("[", "", true)
+	assert.Error(t, err)
+}
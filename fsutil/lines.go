@@ -0,0 +1,177 @@
+package fsutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// SkipRest is used as a return value from a LineFunc to indicate that the rest
+// lines are to be skipped. It is not returned as an error by any function.
+var SkipRest = errors.New("skip the rest lines")
+
+// reverseChunkSize is the size of the chunks read from the end of a file in reverse mode.
+const reverseChunkSize = 64 << 10
+
+// LineFunc is called by WalkLines for each line, n is the line number starting at 1.
+type LineFunc func(n int, line []byte) error
+
+// WalkOptions configures WalkLines.
+type WalkOptions struct {
+	// MaxLineSize is the maximum size of a line, longer lines fail with bufio.ErrTooLong.
+	// Defaults to bufio.MaxScanTokenSize.
+	MaxLineSize int
+	// Split splits the input into lines, defaults to bufio.ScanLines.
+	Split bufio.SplitFunc
+	// Reverse walks the lines from the last one to the first one, and numbers
+	// them from the end, the last line is 1. Gzip input and custom Split
+	// functions are buffered in memory in reverse mode.
+	Reverse bool
+	// Gzip decompresses the gzip compressed files transparently, they are detected
+	// by their magic number, the other files are read as is.
+	Gzip bool
+}
+
+// WalkLines walks the lines of the given file, calling fn for each line. The line
+// is only valid until fn returns. It stops when ctx is done, or fn returns an error, SkipRest
+// stops the walk without error.
+func WalkLines(ctx context.Context, fpath string, opts WalkOptions, fn LineFunc) error {
+	if opts.MaxLineSize <= 0 {
+		opts.MaxLineSize = bufio.MaxScanTokenSize
+	}
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fd.Close() }()
+
+	br := bufio.NewReader(fd)
+	var magic []byte
+	if opts.Gzip {
+		magic, err = br.Peek(2)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		if opts.Reverse && opts.Split == nil {
+			info, err := fd.Stat()
+			if err != nil {
+				return err
+			}
+			err = walkReverse(ctx, fd, info.Size(), opts.MaxLineSize, fn)
+			if errors.Is(err, SkipRest) {
+				return nil
+			}
+			return err
+		}
+		err = walkLines(ctx, br, opts, fn)
+	} else {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(br); err != nil {
+			return err
+		}
+		defer func() { _ = zr.Close() }()
+		err = walkLines(ctx, zr, opts, fn)
+	}
+	if errors.Is(err, SkipRest) {
+		return nil
+	}
+	return err
+}
+
+func walkLines(ctx context.Context, r io.Reader, opts WalkOptions, fn LineFunc) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, min(opts.MaxLineSize, bufio.MaxScanTokenSize)), opts.MaxLineSize)
+	if opts.Split != nil {
+		s.Split(opts.Split)
+	}
+	if opts.Reverse {
+		var lines [][]byte
+		for s.Scan() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			lines = append(lines, bytes.Clone(s.Bytes()))
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+		for i := len(lines) - 1; i >= 0; i-- {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(len(lines)-i, lines[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	n := 0
+	for s.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n++
+		if err := fn(n, s.Bytes()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// walkReverse reads the file backwards by chunks, and splits the lines like bufio.ScanLines.
+func walkReverse(ctx context.Context, r io.ReaderAt, size int64, maxLineSize int, fn LineFunc) error {
+	var (
+		n       int
+		partial []byte
+		offset  = size
+	)
+	emit := func(line []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(line) > maxLineSize {
+			return bufio.ErrTooLong
+		}
+		n++
+		return fn(n, bytes.TrimSuffix(line, []byte{'\r'}))
+	}
+	for offset > 0 {
+		chunk := min(int64(reverseChunkSize), offset)
+		offset -= chunk
+		data := make([]byte, int(chunk)+len(partial))
+		if _, err := r.ReadAt(data[:chunk], offset); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		copy(data[chunk:], partial)
+		for {
+			i := bytes.LastIndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			line := data[i+1:]
+			data = data[:i]
+			// the newline at the end of the file does not start an empty line
+			if int64(i)+offset == size-1 {
+				continue
+			}
+			if err := emit(line); err != nil {
+				return err
+			}
+		}
+		if len(data) > maxLineSize {
+			return bufio.ErrTooLong
+		}
+		partial = data
+	}
+	if size == 0 {
+		return nil
+	}
+	return emit(partial)
+}
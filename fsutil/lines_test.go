@@ -0,0 +1,185 @@
+package fsutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectLines(t *testing.T, fpath string, opts WalkOptions) ([]int, []string, error) {
+	t.Helper()
+	var (
+		nums  []int
+		lines []string
+	)
+	err := WalkLines(context.Background(), fpath, opts, func(n int, line []byte) error {
+		nums = append(nums, n)
+		lines = append(lines, string(line))
+		return nil
+	})
+	return nums, lines, err
+}
+
+func TestWalkLines(t *testing.T) {
+	t.Run("line numbers", func(t *testing.T) {
+		nums, lines, err := collectLines(t, "testdata/src/a.txt", WalkOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3, 4}, nums)
+		assert.Equal(t, []string{"1", "22", "333", "4444"}, lines)
+	})
+
+	t.Run("reverse", func(t *testing.T) {
+		tmp := t.TempDir()
+		for content, expected := range map[string][]string{
+			"":                       nil,
+			"\n":                     {""},
+			"a":                      {"a"},
+			"a\n":                    {"a"},
+			"a\r\n\nb":               {"b", "", "a"},
+			"1\n22\n333\n4444\n\n\n": {"", "", "4444", "333", "22", "1"},
+		} {
+			fpath := filepath.Join(tmp, "lines.txt")
+			assert.NoError(t, os.WriteFile(fpath, []byte(content), 0o644))
+			_, forward, err := collectLines(t, fpath, WalkOptions{})
+			assert.NoError(t, err)
+			nums, lines, err := collectLines(t, fpath, WalkOptions{Reverse: true})
+			assert.NoError(t, err)
+			assert.Equal(t, expected, lines, "content %q", content)
+			assert.Len(t, nums, len(forward))
+			for i, line := range lines {
+				assert.Equal(t, i+1, nums[i])
+				assert.Equal(t, forward[len(forward)-1-i], line)
+			}
+		}
+	})
+
+	t.Run("reverse across chunks", func(t *testing.T) {
+		var (
+			b        strings.Builder
+			expected []string
+		)
+		for i := 0; i < 3*reverseChunkSize/100; i++ {
+			line := strings.Repeat(string(rune('a'+i%26)), i%200)
+			b.WriteString(line + "\n")
+			expected = append([]string{line}, expected...)
+		}
+		fpath := filepath.Join(t.TempDir(), "lines.txt")
+		assert.NoError(t, os.WriteFile(fpath, []byte(b.String()), 0o644))
+		_, lines, err := collectLines(t, fpath, WalkOptions{Reverse: true})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, lines)
+	})
+
+	t.Run("max line size", func(t *testing.T) {
+		fpath := filepath.Join(t.TempDir(), "long.txt")
+		long := strings.Repeat("x", 100<<10)
+		assert.NoError(t, os.WriteFile(fpath, []byte("short\n"+long+"\n"), 0o644))
+
+		_, _, err := collectLines(t, fpath, WalkOptions{})
+		assert.ErrorIs(t, err, bufio.ErrTooLong)
+		_, _, err = collectLines(t, fpath, WalkOptions{Reverse: true})
+		assert.ErrorIs(t, err, bufio.ErrTooLong)
+
+		_, lines, err := collectLines(t, fpath, WalkOptions{MaxLineSize: 1 << 20})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"short", long}, lines)
+		_, lines, err = collectLines(t, fpath, WalkOptions{MaxLineSize: 1 << 20, Reverse: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{long, "short"}, lines)
+	})
+
+	t.Run("skip rest", func(t *testing.T) {
+		for _, reverse := range []bool{false, true} {
+			var lines []string
+			err := WalkLines(context.Background(), "testdata/src/a.txt", WalkOptions{Reverse: reverse}, func(n int, line []byte) error {
+				lines = append(lines, string(line))
+				if n == 2 {
+					return SkipRest
+				}
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Len(t, lines, 2)
+		}
+
+		var lines []string
+		err := Walk("testdata/src/a.txt", func(line []byte) error {
+			lines = append(lines, string(line))
+			return SkipRest
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1"}, lines)
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte("1\n22\n333\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, zw.Close())
+		fpath := filepath.Join(t.TempDir(), "lines.txt.gz")
+		assert.NoError(t, os.WriteFile(fpath, buf.Bytes(), 0o644))
+
+		_, lines, err := collectLines(t, fpath, WalkOptions{Gzip: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1", "22", "333"}, lines)
+		nums, lines, err := collectLines(t, fpath, WalkOptions{Gzip: true, Reverse: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3}, nums)
+		assert.Equal(t, []string{"333", "22", "1"}, lines)
+
+		// the plain files are read as is
+		_, lines, err = collectLines(t, "testdata/src/a.txt", WalkOptions{Gzip: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1", "22", "333", "4444"}, lines)
+
+		// Walk and WalkLines read the raw content by default
+		_, lines, err = collectLines(t, fpath, WalkOptions{})
+		assert.NoError(t, err)
+		var raw []string
+		assert.NoError(t, Walk(fpath, func(line []byte) error {
+			raw = append(raw, string(line))
+			return nil
+		}))
+		assert.Equal(t, lines, raw)
+		assert.True(t, strings.HasPrefix(raw[0], "\x1f\x8b"))
+	})
+
+	t.Run("split", func(t *testing.T) {
+		_, words, err := collectLines(t, "testdata/src/a.txt", WalkOptions{Split: bufio.ScanRunes})
+		assert.NoError(t, err)
+		assert.Equal(t, "1\n22\n333\n4444", strings.Join(words, ""))
+
+		_, words, err = collectLines(t, "testdata/src/a.txt", WalkOptions{Split: bufio.ScanWords, Reverse: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"4444", "333", "22", "1"}, words)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var lines int
+		err := WalkLines(ctx, "testdata/src/a.txt", WalkOptions{}, func(int, []byte) error {
+			lines++
+			cancel()
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, lines)
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		expected := errors.New("test err")
+		err := WalkLines(context.Background(), "testdata/src/a.txt", WalkOptions{Reverse: true}, func(int, []byte) error {
+			return expected
+		})
+		assert.ErrorIs(t, err, expected)
+	})
+}
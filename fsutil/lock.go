@@ -0,0 +1,267 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shipengqi/golib/sysutil"
+)
+
+// ErrLocked is returned when a file is locked by another process.
+var ErrLocked = errors.New("fsutil: file is locked")
+
+const (
+	minLockPoll = time.Millisecond
+	maxLockPoll = 100 * time.Millisecond
+)
+
+// FileLock is an advisory lock on a file, it only excludes the processes that
+// lock the same file. The lock is held by the open file, so two FileLock of the
+// same process exclude each other, and the lock is released if the process dies.
+type FileLock struct {
+	file *os.File
+}
+
+// Lock creates the file if needed, and waits until it holds an exclusive lock on it.
+func Lock(fpath string) (*FileLock, error) {
+	return LockContext(context.Background(), fpath)
+}
+
+// LockContext is like Lock but stops waiting when ctx is done, use
+// context.WithTimeout to wait for a limited time.
+func LockContext(ctx context.Context, fpath string) (*FileLock, error) {
+	return lock(ctx, fpath, true)
+}
+
+// TryLock is like Lock but returns ErrLocked instead of waiting.
+func TryLock(fpath string) (*FileLock, error) {
+	return tryLock(fpath, true)
+}
+
+// RLock creates the file if needed, and waits until it holds a shared lock on it.
+// Several processes can hold a shared lock, while no one holds an exclusive lock.
+func RLock(fpath string) (*FileLock, error) {
+	return RLockContext(context.Background(), fpath)
+}
+
+// RLockContext is like RLock but stops waiting when ctx is done.
+func RLockContext(ctx context.Context, fpath string) (*FileLock, error) {
+	return lock(ctx, fpath, false)
+}
+
+// TryRLock is like RLock but returns ErrLocked instead of waiting.
+func TryRLock(fpath string) (*FileLock, error) {
+	return tryLock(fpath, false)
+}
+
+// Path returns the path of the locked file.
+func (l *FileLock) Path() string {
+	return l.file.Name()
+}
+
+// Unlock releases the lock and closes the file.
+func (l *FileLock) Unlock() error {
+	err := unlockFile(l.file)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// current reports whether the locked file is still the one at its path.
+func (l *FileLock) current() (bool, error) {
+	info, err := l.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	pinfo, err := os.Stat(l.file.Name())
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(info, pinfo), nil
+}
+
+func openLockFile(fpath string, exclusive bool) (*os.File, error) {
+	flag := os.O_RDONLY
+	if exclusive {
+		flag = os.O_RDWR
+	}
+	return os.OpenFile(fpath, flag|os.O_CREATE, 0o644)
+}
+
+func tryLock(fpath string, exclusive bool) (*FileLock, error) {
+	f, err := openLockFile(fpath, exclusive)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f, exclusive, false); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &FileLock{file: f}, nil
+}
+
+func lock(ctx context.Context, fpath string, exclusive bool) (*FileLock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := openLockFile(fpath, exclusive)
+	if err != nil {
+		return nil, err
+	}
+	// a blocking lock cannot be interrupted, so it is only used without a deadline.
+	if ctx.Done() == nil {
+		if err = lockFile(f, exclusive, true); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &FileLock{file: f}, nil
+	}
+
+	poll := minLockPoll
+	for {
+		err = lockFile(f, exclusive, false)
+		if err == nil {
+			return &FileLock{file: f}, nil
+		}
+		if !errors.Is(err, ErrLocked) {
+			_ = f.Close()
+			return nil, err
+		}
+		timer := time.NewTimer(poll)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			_ = f.Close()
+			return nil, ctx.Err()
+		}
+		poll = min(2*poll, maxLockPoll)
+	}
+}
+
+// PIDFile is a locked file holding the PID of the process that owns it.
+type PIDFile struct {
+	lock     *FileLock
+	stalePID int
+}
+
+// LockPIDFile locks the file and writes the PID of the current process into it.
+// It returns an error that matches ErrLocked if the file is locked by another
+// process. Once the lock is held, the PID left in the file is stale, even if it
+// was reused by a running process, it is replaced and reported by StalePID.
+func LockPIDFile(fpath string) (*PIDFile, error) {
+	l, err := tryLockPIDFile(fpath)
+	if errors.Is(err, ErrLocked) {
+		if pid, rerr := ReadPIDFile(fpath); rerr == nil {
+			return nil, fmt.Errorf("%w: %s is held by process %d", ErrLocked, fpath, pid)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := readPID(l.file)
+	if err != nil {
+		_ = l.Unlock()
+		return nil, err
+	}
+	p := &PIDFile{lock: l}
+	if pid != sysutil.PID() {
+		p.stalePID = pid
+	}
+	if err = l.file.Truncate(0); err == nil {
+		_, err = l.file.WriteAt([]byte(strconv.Itoa(sysutil.PID())+"\n"), 0)
+	}
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		_ = l.Unlock()
+		return nil, err
+	}
+	return p, nil
+}
+
+// tryLockPIDFile locks the file at fpath. The owner removes the file before
+// releasing its lock, so the lock may be taken on a removed file, that is
+// retried until the locked file is the one at fpath.
+func tryLockPIDFile(fpath string) (*FileLock, error) {
+	for {
+		l, err := TryLock(fpath)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := l.current()
+		if ok {
+			return l, nil
+		}
+		_ = l.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// StalePID returns the PID of the dead process that was found in the file, or zero.
+func (p *PIDFile) StalePID() int {
+	return p.stalePID
+}
+
+// Path returns the path of the PID file.
+func (p *PIDFile) Path() string {
+	return p.lock.Path()
+}
+
+// Unlock removes the PID file and releases the lock.
+func (p *PIDFile) Unlock() error {
+	if sysutil.IsWindows() {
+		// an open file cannot be removed on Windows
+		err := p.lock.Unlock()
+		if rerr := os.Remove(p.lock.Path()); err == nil {
+			err = rerr
+		}
+		return err
+	}
+	err := os.Remove(p.lock.Path())
+	if uerr := p.lock.Unlock(); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// ReadPIDFile returns the PID written in the given file, zero if the file is empty.
+func ReadPIDFile(fpath string) (int, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	return readPID(f)
+}
+
+func readPID(f *os.File) (int, error) {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 32))
+	if err != nil {
+		return 0, err
+	}
+	content := strings.TrimSpace(string(data))
+	if content == "" {
+		return 0, nil
+	}
+	pid, err := strconv.Atoi(content)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid file %s: %q", f.Name(), content)
+	}
+	return pid, nil
+}
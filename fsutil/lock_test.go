@@ -0,0 +1,158 @@
+package fsutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shipengqi/golib/sysutil"
+)
+
+func TestLock(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "state.lock")
+
+	l, err := Lock(fpath)
+	assert.NoError(t, err)
+	assert.Equal(t, fpath, l.Path())
+
+	_, err = TryLock(fpath)
+	assert.ErrorIs(t, err, ErrLocked)
+	_, err = TryRLock(fpath)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = LockContext(ctx, fpath)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// waits until the lock is released
+	locked := make(chan *FileLock)
+	go func() {
+		l2, err := LockContext(context.Background(), fpath)
+		assert.NoError(t, err)
+		locked <- l2
+	}()
+	select {
+	case <-locked:
+		t.Fatal("locked twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.NoError(t, l.Unlock())
+	l2 := <-locked
+	assert.NoError(t, l2.Unlock())
+}
+
+func TestRLock(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "state.lock")
+
+	r1, err := RLock(fpath)
+	assert.NoError(t, err)
+	r2, err := TryRLock(fpath)
+	assert.NoError(t, err)
+	_, err = TryLock(fpath)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	locked := make(chan error)
+	go func() {
+		l, err := LockContext(ctx, fpath)
+		if err == nil {
+			err = l.Unlock()
+		}
+		locked <- err
+	}()
+	assert.NoError(t, r1.Unlock())
+	assert.NoError(t, r2.Unlock())
+	assert.NoError(t, <-locked)
+
+	_, err = RLockContext(ctx, filepath.Join(t.TempDir(), "missing", "state.lock"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLockPIDFile(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "app.pid")
+
+	p, err := LockPIDFile(fpath)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, p.StalePID())
+	pid, err := ReadPIDFile(fpath)
+	assert.NoError(t, err)
+	assert.Equal(t, sysutil.PID(), pid)
+
+	_, err = LockPIDFile(fpath)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.Contains(t, err.Error(), strconv.Itoa(sysutil.PID()))
+
+	assert.NoError(t, p.Unlock())
+	assert.False(t, IsExists(fpath))
+
+	t.Run("stale pid", func(t *testing.T) {
+		// a PID greater than the maximum PID of Linux and macOS
+		assert.NoError(t, os.WriteFile(fpath, []byte("2147483600\n"), 0o644))
+		p, err := LockPIDFile(fpath)
+		assert.NoError(t, err)
+		assert.Equal(t, 2147483600, p.StalePID())
+		pid, err := ReadPIDFile(fpath)
+		assert.NoError(t, err)
+		assert.Equal(t, sysutil.PID(), pid)
+		assert.NoError(t, p.Unlock())
+	})
+
+	t.Run("pid of a running process", func(t *testing.T) {
+		if sysutil.IsWindows() {
+			t.Skip("no process with a well-known PID")
+		}
+		// the PID was reused after a reboot, the lock is authoritative
+		assert.NoError(t, os.WriteFile(fpath, []byte("1"), 0o644))
+		p, err := LockPIDFile(fpath)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, p.StalePID())
+		assert.NoError(t, p.Unlock())
+	})
+
+	t.Run("removed file", func(t *testing.T) {
+		if sysutil.IsWindows() {
+			t.Skip("an open file cannot be removed on Windows")
+		}
+		l, err := TryLock(fpath)
+		assert.NoError(t, err)
+		ok, err := l.current()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		// the owner removed the file after it was opened
+		assert.NoError(t, os.Remove(fpath))
+		ok, err = l.current()
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		// another process created a new file at the same path
+		assert.NoError(t, os.WriteFile(fpath, nil, 0o644))
+		ok, err = l.current()
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.NoError(t, l.Unlock())
+
+		p, err := LockPIDFile(fpath)
+		assert.NoError(t, err)
+		ok, err = p.lock.current()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.NoError(t, p.Unlock())
+	})
+
+	t.Run("invalid pid", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(fpath, []byte("abc"), 0o644))
+		_, err := LockPIDFile(fpath)
+		assert.Error(t, err)
+		l, err := TryLock(fpath)
+		assert.NoError(t, err, "the lock is released on error")
+		assert.NoError(t, l.Unlock())
+	})
+}
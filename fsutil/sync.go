@@ -0,0 +1,268 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/shipengqi/golib/cryptoutil/xsha256"
+)
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	// Checksum compares the files by their SHA256 checksum instead of their size
+	// and modification time.
+	Checksum bool
+	// Delete removes the entries of dst that do not exist in src.
+	Delete bool
+	// DryRun only reports the changes without touching dst.
+	DryRun bool
+	// Exclude is a list of glob patterns like CopyOptions.Exclude, the matching
+	// entries are neither copied nor deleted.
+	Exclude []string
+}
+
+// SyncReport holds the slash-separated paths relative to dst of the entries changed by Sync.
+type SyncReport struct {
+	Added   []string
+	Updated []string
+	Deleted []string
+}
+
+// Changed reports whether Sync changed anything.
+func (r *SyncReport) Changed() bool {
+	return len(r.Added)+len(r.Updated)+len(r.Deleted) > 0
+}
+
+// Sync mirrors the src directory into dst like rsync. The new and changed files
+// are copied along with their modification times, symlinks are copied as links,
+// and the extra entries of dst are removed if opts.Delete is set.
+func Sync(src, dst string, opts SyncOptions) (*SyncReport, error) {
+	for _, pattern := range opts.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "sync", Path: src, Err: errors.New("not a directory")}
+	}
+	s := &syncer{opts: opts, report: &SyncReport{}}
+	if !opts.DryRun {
+		if err = os.MkdirAll(dst, info.Mode().Perm()); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.syncDir(src, dst, "."); err != nil {
+		return s.report, err
+	}
+	sort.Strings(s.report.Added)
+	sort.Strings(s.report.Updated)
+	sort.Strings(s.report.Deleted)
+	return s.report, nil
+}
+
+type syncer struct {
+	opts   SyncOptions
+	report *SyncReport
+}
+
+func (s *syncer) syncDir(src, dst, rel string) error {
+	sfds, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	dfds, err := os.ReadDir(dst)
+	if err != nil && !(s.opts.DryRun && errors.Is(err, fs.ErrNotExist)) {
+		return err
+	}
+	extra := make(map[string]bool, len(dfds))
+	for _, fd := range dfds {
+		extra[fd.Name()] = true
+	}
+
+	for _, fd := range sfds {
+		delete(extra, fd.Name())
+		frel := path.Join(rel, fd.Name())
+		if matchAny(s.opts.Exclude, frel) {
+			continue
+		}
+		if err = s.syncEntry(filepath.Join(src, fd.Name()), filepath.Join(dst, fd.Name()), frel); err != nil {
+			return err
+		}
+	}
+
+	if !s.opts.Delete {
+		return nil
+	}
+	for _, fd := range dfds {
+		frel := path.Join(rel, fd.Name())
+		if !extra[fd.Name()] || matchAny(s.opts.Exclude, frel) {
+			continue
+		}
+		if _, err = s.remove(filepath.Join(dst, fd.Name()), frel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syncer) syncEntry(src, dst, rel string) error {
+	sinfo, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	dinfo, err := os.Lstat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s.add(src, dst, rel)
+	}
+	if err != nil {
+		return err
+	}
+	if sinfo.IsDir() && dinfo.IsDir() {
+		return s.syncDir(src, dst, rel)
+	}
+	changed, err := s.changed(src, dst, sinfo, dinfo)
+	if err != nil || !changed {
+		return err
+	}
+	s.report.Updated = append(s.report.Updated, rel)
+	if s.opts.DryRun {
+		return nil
+	}
+	if sinfo.Mode().IsRegular() && dinfo.Mode().IsRegular() {
+		if err = CopyFile(src, dst); err != nil {
+			return err
+		}
+		return lchtimes(dst, sinfo)
+	}
+	// the type of the entry changed
+	if err = os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return s.copy(src, dst, rel)
+}
+
+// changed reports whether the non-directory entry dst differs from src.
+func (s *syncer) changed(src, dst string, sinfo, dinfo fs.FileInfo) (bool, error) {
+	if sinfo.Mode().Type() != dinfo.Mode().Type() {
+		return true, nil
+	}
+	switch {
+	case sinfo.Mode()&fs.ModeSymlink != 0:
+		starget, err := os.Readlink(src)
+		if err != nil {
+			return false, err
+		}
+		dtarget, err := os.Readlink(dst)
+		if err != nil {
+			return false, err
+		}
+		return starget != dtarget, nil
+	case sinfo.Mode().IsRegular():
+		if sinfo.Size() != dinfo.Size() {
+			return true, nil
+		}
+		if !s.opts.Checksum {
+			return !sinfo.ModTime().Equal(dinfo.ModTime()), nil
+		}
+		ssum, err := xsha256.EncryptFile(src)
+		if err != nil {
+			return false, err
+		}
+		dsum, err := xsha256.EncryptFile(dst)
+		if err != nil {
+			return false, err
+		}
+		return ssum != dsum, nil
+	default:
+		return false, nil
+	}
+}
+
+// add copies the new entry src, and reports it along with its children.
+func (s *syncer) add(src, dst, rel string) error {
+	err := s.walk(src, rel, func(frel string) {
+		s.report.Added = append(s.report.Added, frel)
+	})
+	if err != nil || s.opts.DryRun {
+		return err
+	}
+	return s.copy(src, dst, rel)
+}
+
+// remove deletes the extra entry dst and its children that are not excluded, and
+// reports them. A directory that still holds excluded entries is kept, it reports
+// whether dst was removed.
+func (s *syncer) remove(dst, rel string) (bool, error) {
+	info, err := os.Lstat(dst)
+	if err != nil {
+		return false, err
+	}
+	removed := true
+	if info.IsDir() {
+		fds, err := os.ReadDir(dst)
+		if err != nil {
+			return false, err
+		}
+		for _, fd := range fds {
+			frel := path.Join(rel, fd.Name())
+			if matchAny(s.opts.Exclude, frel) {
+				removed = false
+				continue
+			}
+			ok, err := s.remove(filepath.Join(dst, fd.Name()), frel)
+			if err != nil {
+				return false, err
+			}
+			removed = removed && ok
+		}
+	}
+	if !removed {
+		return false, nil
+	}
+	s.report.Deleted = append(s.report.Deleted, rel)
+	if s.opts.DryRun {
+		return true, nil
+	}
+	return true, os.Remove(dst)
+}
+
+func (s *syncer) copy(src, dst, rel string) error {
+	return copyTree(context.Background(), src, dst, rel, CopyOptions{
+		KeepSymlinks:  true,
+		PreserveTimes: true,
+		Exclude:       s.opts.Exclude,
+	})
+}
+
+// walk calls fn with the relative path of root and each of its children, skipping
+// the excluded ones.
+func (s *syncer) walk(root, rel string, fn func(rel string)) error {
+	return filepath.WalkDir(root, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		frel, err := filepath.Rel(root, fpath)
+		if err != nil {
+			return err
+		}
+		frel = path.Join(rel, filepath.ToSlash(frel))
+		if fpath != root && matchAny(s.opts.Exclude, frel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fn(frel)
+		return nil
+	})
+}
@@ -0,0 +1,142 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSync(t *testing.T) {
+	t.Run("mirror a new tree", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		report, err := Sync(src, dst, SyncOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"a.txt", "b.log", "link", "sub", "sub/c.txt", "sub/d.log", "vendor", "vendor/e.txt",
+		}, report.Added)
+		assert.Empty(t, report.Updated)
+		assert.Equal(t, listTree(t, src), listTree(t, dst))
+		assert.True(t, isLink(t, filepath.Join(dst, "link")))
+
+		// nothing changed
+		report, err = Sync(src, dst, SyncOptions{})
+		assert.NoError(t, err)
+		assert.False(t, report.Changed())
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		_, err := Sync(src, dst, SyncOptions{})
+		assert.NoError(t, err)
+
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("new content"), 0o644))
+		assert.NoError(t, os.Remove(filepath.Join(src, "link")))
+		assert.NoError(t, os.Symlink("b.log", filepath.Join(src, "link")))
+		assert.NoError(t, os.RemoveAll(filepath.Join(src, "vendor")))
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, "sub", "extra.txt"), nil, 0o644))
+
+		report, err := Sync(src, dst, SyncOptions{DryRun: true, Delete: true})
+		assert.NoError(t, err)
+		assert.Equal(t, &SyncReport{
+			Updated: []string{"a.txt", "link"},
+			Deleted: []string{"sub/extra.txt", "vendor", "vendor/e.txt"},
+		}, report)
+		assert.True(t, IsExists(filepath.Join(dst, "vendor")))
+
+		report, err = Sync(src, dst, SyncOptions{})
+		assert.NoError(t, err)
+		assert.Empty(t, report.Deleted)
+		assert.True(t, IsExists(filepath.Join(dst, "vendor")))
+
+		report, err = Sync(src, dst, SyncOptions{Delete: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"sub/extra.txt", "vendor", "vendor/e.txt"}, report.Deleted)
+		assert.Equal(t, listTree(t, src), listTree(t, dst))
+		got, err := os.ReadFile(filepath.Join(dst, "a.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "new content", string(got))
+		target, err := os.Readlink(filepath.Join(dst, "link"))
+		assert.NoError(t, err)
+		assert.Equal(t, "b.log", target)
+	})
+
+	t.Run("compare by checksum", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		_, err := Sync(src, dst, SyncOptions{})
+		assert.NoError(t, err)
+
+		// same size and content, only the modification time changed
+		mtime := time.Now().Add(time.Hour)
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "a.txt"), mtime, mtime))
+		report, err := Sync(src, dst, SyncOptions{Checksum: true, DryRun: true})
+		assert.NoError(t, err)
+		assert.False(t, report.Changed())
+		report, err = Sync(src, dst, SyncOptions{DryRun: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a.txt"}, report.Updated)
+
+		// same size and modification time, the content changed
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, "b.log"), []byte("x"), 0o644))
+		info, err := os.Stat(filepath.Join(src, "b.log"))
+		assert.NoError(t, err)
+		assert.NoError(t, os.Chtimes(filepath.Join(dst, "b.log"), info.ModTime(), info.ModTime()))
+		report, err = Sync(src, dst, SyncOptions{Checksum: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b.log"}, report.Updated)
+		got, err := os.ReadFile(filepath.Join(dst, "b.log"))
+		assert.NoError(t, err)
+		assert.Equal(t, "b", string(got))
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, "vendor"), 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, "vendor", "kept.txt"), nil, 0o644))
+		report, err := Sync(src, dst, SyncOptions{Delete: true, Exclude: []string{"vendor", "sub/*.log"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a.txt", "b.log", "link", "sub", "sub/c.txt"}, report.Added)
+		assert.Empty(t, report.Deleted)
+		assert.True(t, IsExists(filepath.Join(dst, "vendor", "kept.txt")))
+		assert.False(t, IsExists(filepath.Join(dst, "sub", "d.log")))
+	})
+
+	t.Run("exclude in extra directory", func(t *testing.T) {
+		src := newCopyTree(t)
+		dst := filepath.Join(t.TempDir(), "dst")
+		for _, name := range []string{"extra/keep.log", "extra/deep/keep.log", "extra/deep/gone.txt", "extra/gone/gone.txt"} {
+			assert.NoError(t, os.MkdirAll(filepath.Join(dst, filepath.Dir(name)), 0o755))
+			assert.NoError(t, os.WriteFile(filepath.Join(dst, name), nil, 0o644))
+		}
+		report, err := Sync(src, dst, SyncOptions{Delete: true, Exclude: []string{"*.log"}, DryRun: true})
+		assert.NoError(t, err)
+		expected := []string{"extra/deep/gone.txt", "extra/gone", "extra/gone/gone.txt"}
+		assert.Equal(t, expected, report.Deleted)
+
+		report, err = Sync(src, dst, SyncOptions{Delete: true, Exclude: []string{"*.log"}})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, report.Deleted)
+		assert.True(t, IsExists(filepath.Join(dst, "extra", "keep.log")))
+		assert.True(t, IsExists(filepath.Join(dst, "extra", "deep", "keep.log")))
+		assert.False(t, IsExists(filepath.Join(dst, "extra", "deep", "gone.txt")))
+		assert.False(t, IsExists(filepath.Join(dst, "extra", "gone")))
+	})
+
+	t.Run("not a directory", func(t *testing.T) {
+		_, err := Sync("testdata/src/a.txt", t.TempDir(), SyncOptions{})
+		assert.Error(t, err)
+	})
+}
+
+func isLink(t *testing.T, fpath string) bool {
+	t.Helper()
+	info, err := os.Lstat(fpath)
+	assert.NoError(t, err)
+	return info.Mode()&os.ModeSymlink != 0
+}
@@ -4,11 +4,14 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Tar create a new archive.
@@ -22,15 +25,48 @@ func Tar(src, dst string) error {
 	return tarf(fw, src)
 }
 
+// ErrUnsafePath is returned when an archive entry or link would be extracted outside dst.
+var ErrUnsafePath = errors.New("fsutil: unsafe path in archive")
+
+// ErrArchiveLimit is returned when an archive exceeds the limits of UnTarOptions.
+var ErrArchiveLimit = errors.New("fsutil: archive exceeds the extraction limits")
+
+// UnTarOptions configures UnTarWithOptions and DeCompressWithOptions, the zero
+// value extracts like UnTar.
+type UnTarOptions struct {
+	// PreserveOwner restores the uid and gid of the entries, it usually requires root.
+	PreserveOwner bool
+	// PreserveMode restores the exact permission bits of the entries, including the
+	// setuid, setgid and sticky bits, regardless of the umask.
+	PreserveMode bool
+	// PreserveTimes restores the modification and access times of the entries.
+	PreserveTimes bool
+	// MaxSize is the maximum total size of the extracted files, zero means no limit.
+	MaxSize int64
+	// MaxFiles is the maximum number of entries in the archive, zero means no limit.
+	MaxFiles int
+	// MaxRatio is the maximum ratio of the extracted bytes to the bytes read from the
+	// archive file, zero means no limit.
+	MaxRatio float64
+}
+
 // UnTar extract all files from an archive.
+// The entries are resolved beneath dst, an entry or a link that would escape it returns
+// an error that matches ErrUnsafePath. Devices and named pipes are skipped.
 func UnTar(src, dst string) (err error) {
+	return UnTarWithOptions(src, dst, UnTarOptions{})
+}
+
+// UnTarWithOptions is like UnTar with the given options.
+func UnTarWithOptions(src, dst string, opts UnTarOptions) (err error) {
 	fr, err := os.Open(src)
 	if err != nil {
 		return
 	}
 	defer func() { _ = fr.Close() }()
 
-	return untar(fr, dst)
+	cr := &countingReader{r: fr}
+	return untar(cr, cr, dst, opts)
 }
 
 // Compress is like Tar but will use gzip to compress.
@@ -49,6 +85,11 @@ func Compress(src, dst string) error {
 
 // DeCompress is like UnTar but will use gzip to decompress.
 func DeCompress(src, dst string) (err error) {
+	return DeCompressWithOptions(src, dst, UnTarOptions{})
+}
+
+// DeCompressWithOptions is like DeCompress with the given options.
+func DeCompressWithOptions(src, dst string, opts UnTarOptions) (err error) {
 	fr, err := os.Open(src)
 	if err != nil {
 		return
@@ -56,13 +97,14 @@ func DeCompress(src, dst string) (err error) {
 	defer func() { _ = fr.Close() }()
 
 	// uncompress
-	gr, err := gzip.NewReader(fr)
+	cr := &countingReader{r: fr}
+	gr, err := gzip.NewReader(cr)
 	if err != nil {
 		return
 	}
 	defer func() { _ = gr.Close() }()
 
-	return untar(gr, dst)
+	return untar(gr, cr, dst, opts)
 }
 
 func tarf(writer io.Writer, src string) error {
@@ -98,7 +140,18 @@ func tarf(writer io.Writer, src string) error {
 	})
 }
 
-func untar(reader io.Reader, dst string) error {
+// untar extracts the archive read from reader, src counts the bytes read from the archive file.
+func untar(reader io.Reader, src *countingReader, dst string, opts UnTarOptions) error {
+	if err := MkDirAll(dst); err != nil {
+		return err
+	}
+	x, err := newExtractor(dst)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = x.close() }()
+
+	u := &untarrer{x: x, opts: opts, src: src}
 	tr := tar.NewReader(reader)
 	for {
 		header, err := tr.Next()
@@ -108,40 +161,241 @@ func untar(reader io.Reader, dst string) error {
 			}
 			return err
 		}
-		// Zip Slip Vulnerability
-		// See https://cwe.mitre.org/data/definitions/22.html
-		if strings.Contains(header.Name, "..") {
-			continue
+		if err = u.extract(tr, header); err != nil {
+			return err
 		}
-		dstPath := filepath.Join(dst, header.Name)
-		baseDir := filepath.Dir(dstPath)
-		if err = MkDirAll(baseDir); err != nil {
+	}
+	// the attributes of directories are restored after their children are extracted,
+	// so that the modification times are kept.
+	for i := len(u.dirs) - 1; i >= 0; i-- {
+		if err = u.restore(u.dirs[i].name, u.dirs[i].header); err != nil {
 			return err
 		}
+	}
+	return nil
+}
+
+// extractor creates the entries of an archive, the slash-separated names are
+// resolved beneath its root directory, and never follow a symlink out of it.
+type extractor interface {
+	mkdirAll(name string, perm fs.FileMode) error
+	// create creates a new regular file, it replaces an existing file or symlink.
+	create(name string, perm fs.FileMode) (*os.File, error)
+	// symlink creates a symlink, it replaces an existing file or symlink.
+	symlink(target, name string) error
+	// link creates a hard link, it replaces an existing file or symlink.
+	link(oldname, name string) error
+	// lmode returns the type bits of the mode of an entry, it does not follow symlinks.
+	lmode(name string) (fs.FileMode, error)
+	lchown(name string, uid, gid int) error
+	// chmod follows symlinks, it must not be called on a symlink.
+	chmod(name string, mode fs.FileMode) error
+	lchtimes(name string, atime, mtime time.Time) error
+	close() error
+}
+
+type untarDir struct {
+	name   string
+	header *tar.Header
+}
+
+type untarrer struct {
+	x    extractor
+	opts UnTarOptions
+	src  *countingReader
 
-		switch header.Typeflag {
-		case tar.TypeDir: // directory
-			if err = MkDirAll(dstPath); err != nil {
+	dirs      []untarDir
+	files     int
+	size      int64
+	extracted int64
+}
+
+func (u *untarrer) extract(tr *tar.Reader, header *tar.Header) error {
+	u.files++
+	if u.opts.MaxFiles > 0 && u.files > u.opts.MaxFiles {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, u.opts.MaxFiles)
+	}
+	name, err := localName(header.Name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return nil
+	}
+	if dir := path.Dir(name); dir != "." {
+		if err = u.x.mkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir: // directory
+		if err = u.x.mkdirAll(name, os.ModePerm); err != nil {
+			return err
+		}
+		u.dirs = append(u.dirs, untarDir{name: name, header: header})
+		return nil
+	case tar.TypeReg: // file
+		if err = u.createFile(tr, name, header); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		// the target is resolved from the directory of the link
+		if err = u.checkSymlink(name, header.Linkname); err != nil {
+			return err
+		}
+		if err = u.x.symlink(header.Linkname, name); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		oldname, err := localName(header.Linkname)
+		if err != nil {
+			return err
+		}
+		// a hard link to a symlink would resolve its target from another directory
+		mode, err := u.x.lmode(oldname)
+		if err != nil {
+			return err
+		}
+		if !mode.IsRegular() {
+			return &fs.PathError{Op: "untar", Path: header.Name, Err: ErrUnsafePath}
+		}
+		// the attributes belong to the linked file
+		return u.x.link(oldname, name)
+	default:
+		// skips devices, named pipes and the others
+		return nil
+	}
+	return u.restore(name, header)
+}
+
+// checkSymlink returns ErrUnsafePath if the symlink name may resolve its target
+// outside dst. The ".." elements of the target are resolved from real directories:
+// the directory of the link and the directories named before a "..", which must
+// exist and not be symlinks, a symlink may point elsewhere or be replaced later.
+func (u *untarrer) checkSymlink(name, target string) error {
+	unsafe := &fs.PathError{Op: "untar", Path: name, Err: ErrUnsafePath}
+	if path.IsAbs(target) {
+		return unsafe
+	}
+	if _, err := localName(path.Join(path.Dir(name), target)); err != nil {
+		return err
+	}
+	// the directories from dst down to checked are known to be real
+	checked, cur := ".", path.Dir(name)
+	for _, elem := range strings.Split(target, "/") {
+		switch elem {
+		case "", ".":
+		case "..":
+			ok, err := u.realDirs(checked, cur)
+			if err != nil {
 				return err
 			}
-		case tar.TypeReg: // file
-			if err = createf(tr, dstPath, header.FileInfo().Mode()); err != nil {
-				return err
+			if !ok {
+				return unsafe
 			}
+			checked, cur = path.Dir(cur), path.Dir(cur)
+		default:
+			cur = path.Join(cur, elem)
 		}
 	}
 	return nil
 }
 
-func createf(src io.Reader, dst string, mode os.FileMode) error {
-	file, err := os.OpenFile(dst, os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode)
+// realDirs reports whether the directories from dir down to its descendant name
+// exist and are not symlinks.
+func (u *untarrer) realDirs(dir, name string) (bool, error) {
+	for ; name != dir && name != "."; name = path.Dir(name) {
+		mode, err := u.x.lmode(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !mode.IsDir() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (u *untarrer) createFile(tr *tar.Reader, name string, header *tar.Header) error {
+	u.size += header.Size
+	if u.opts.MaxSize > 0 && u.size > u.opts.MaxSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrArchiveLimit, u.opts.MaxSize)
+	}
+	file, err := u.x.create(name, header.FileInfo().Mode().Perm())
 	if err != nil {
 		return err
 	}
 	defer func() { _ = file.Close() }()
-	_, err = io.Copy(file, src)
-	if err != nil {
+	if _, err = io.Copy(file, &ratioReader{r: tr, u: u}); err != nil {
 		return err
 	}
+	return file.Close()
+}
+
+// restore restores the attributes of an entry asked by the options.
+func (u *untarrer) restore(name string, header *tar.Header) error {
+	if u.opts.PreserveOwner {
+		if err := u.x.lchown(name, header.Uid, header.Gid); err != nil {
+			return err
+		}
+	}
+	// after chown, which clears the setuid and setgid bits
+	if u.opts.PreserveMode && header.Typeflag != tar.TypeSymlink {
+		mode := header.FileInfo().Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		if err := u.x.chmod(name, mode); err != nil {
+			return err
+		}
+	}
+	if u.opts.PreserveTimes {
+		atime := header.AccessTime
+		if atime.IsZero() {
+			atime = header.ModTime
+		}
+		if err := u.x.lchtimes(name, atime, header.ModTime); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// localName returns the cleaned slash-separated name of an archive entry, a leading
+// slash is removed like GNU tar does.
+func localName(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimLeft(name, "/"))
+	if cleaned != "." && !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+		return "", &fs.PathError{Op: "untar", Path: name, Err: ErrUnsafePath}
+	}
+	return cleaned, nil
+}
+
+// countingReader counts the bytes read from an archive file.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ratioReader counts the extracted bytes, and checks the compression ratio.
+type ratioReader struct {
+	r io.Reader
+	u *untarrer
+}
+
+func (r *ratioReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	u := r.u
+	u.extracted += int64(n)
+	if u.opts.MaxRatio > 0 && float64(u.extracted) > u.opts.MaxRatio*float64(u.src.n) {
+		return n, fmt.Errorf("%w: compression ratio over %g", ErrArchiveLimit, u.opts.MaxRatio)
+	}
+	return n, err
+}
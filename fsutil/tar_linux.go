@@ -0,0 +1,217 @@
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// beneathExtractor resolves the names with openat2(2) and RESOLVE_BENEATH, then
+// creates the entries relative to their parent directory.
+type beneathExtractor struct {
+	dst string
+	fd  int
+}
+
+// newExtractor uses openat2 if the kernel supports it (Linux 5.6+), os.Root otherwise.
+func newExtractor(dst string) (extractor, error) {
+	fd, err := unix.Open(dst, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: dst, Err: err}
+	}
+	x := &beneathExtractor{dst: dst, fd: fd}
+	probe, err := x.openDir(".")
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+		_ = unix.Close(fd)
+		return newRootExtractor(dst)
+	}
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, &fs.PathError{Op: "openat2", Path: dst, Err: err}
+	}
+	_ = unix.Close(probe)
+	return x, nil
+}
+
+// openDir opens a directory beneath dst, the caller closes it.
+func (x *beneathExtractor) openDir(dir string) (int, error) {
+	how := &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+	}
+	for {
+		fd, err := unix.Openat2(x.fd, dir, how)
+		// EAGAIN is returned if a rename raced with the resolution
+		if errors.Is(err, unix.EINTR) || errors.Is(err, unix.EAGAIN) {
+			continue
+		}
+		return fd, err
+	}
+}
+
+// at calls fn with the parent directory of name and its base name.
+func (x *beneathExtractor) at(op, name string, fn func(dirfd int, base string) error) error {
+	dir, base := path.Split(name)
+	dirfd := x.fd
+	if dir = strings.TrimSuffix(dir, "/"); dir != "" {
+		fd, err := x.openDir(dir)
+		if err != nil {
+			if errors.Is(err, unix.EXDEV) {
+				err = ErrUnsafePath
+			}
+			return &fs.PathError{Op: "openat2", Path: filepath.Join(x.dst, dir), Err: err}
+		}
+		defer func() { _ = unix.Close(fd) }()
+		dirfd = fd
+	}
+	if err := fn(dirfd, base); err != nil {
+		return &fs.PathError{Op: op, Path: filepath.Join(x.dst, name), Err: err}
+	}
+	return nil
+}
+
+func (x *beneathExtractor) mkdirAll(name string, perm fs.FileMode) error {
+	parts := strings.Split(name, "/")
+	for i := range parts {
+		err := x.at("mkdir", strings.Join(parts[:i+1], "/"), func(dirfd int, base string) error {
+			err := unix.Mkdirat(dirfd, base, uint32(perm.Perm()))
+			if !errors.Is(err, unix.EEXIST) {
+				return err
+			}
+			var st unix.Stat_t
+			if err = unix.Fstatat(dirfd, base, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+				return err
+			}
+			// a symlink to a directory is resolved beneath dst by the next openat2
+			if st.Mode&unix.S_IFMT != unix.S_IFDIR && st.Mode&unix.S_IFMT != unix.S_IFLNK {
+				return unix.ENOTDIR
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlink removes an existing file or symlink.
+func unlink(dirfd int, base string) error {
+	err := unix.Unlinkat(dirfd, base, 0)
+	if errors.Is(err, unix.ENOENT) {
+		return nil
+	}
+	return err
+}
+
+func (x *beneathExtractor) create(name string, perm fs.FileMode) (*os.File, error) {
+	var file *os.File
+	err := x.at("open", name, func(dirfd int, base string) error {
+		if err := unlink(dirfd, base); err != nil {
+			return err
+		}
+		fd, err := unix.Openat(dirfd, base, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW|unix.O_CLOEXEC, uint32(perm.Perm()))
+		if err != nil {
+			return err
+		}
+		file = os.NewFile(uintptr(fd), filepath.Join(x.dst, name))
+		return nil
+	})
+	return file, err
+}
+
+func (x *beneathExtractor) symlink(target, name string) error {
+	return x.at("symlink", name, func(dirfd int, base string) error {
+		if err := unlink(dirfd, base); err != nil {
+			return err
+		}
+		return unix.Symlinkat(target, dirfd, base)
+	})
+}
+
+func (x *beneathExtractor) link(oldname, name string) error {
+	return x.at("link", oldname, func(olddirfd int, oldbase string) error {
+		return x.at("link", name, func(dirfd int, base string) error {
+			if err := unlink(dirfd, base); err != nil {
+				return err
+			}
+			// without AT_SYMLINK_FOLLOW, a symlink is not followed
+			return unix.Linkat(olddirfd, oldbase, dirfd, base, 0)
+		})
+	})
+}
+
+func (x *beneathExtractor) lmode(name string) (fs.FileMode, error) {
+	var st unix.Stat_t
+	err := x.at("lstat", name, func(dirfd int, base string) error {
+		return unix.Fstatat(dirfd, base, &st, unix.AT_SYMLINK_NOFOLLOW)
+	})
+	if err != nil {
+		return 0, err
+	}
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFREG:
+		return 0, nil
+	case unix.S_IFDIR:
+		return fs.ModeDir, nil
+	case unix.S_IFLNK:
+		return fs.ModeSymlink, nil
+	default:
+		return fs.ModeIrregular, nil
+	}
+}
+
+func (x *beneathExtractor) lchown(name string, uid, gid int) error {
+	return x.at("lchown", name, func(dirfd int, base string) error {
+		return unix.Fchownat(dirfd, base, uid, gid, unix.AT_SYMLINK_NOFOLLOW)
+	})
+}
+
+func (x *beneathExtractor) chmod(name string, mode fs.FileMode) error {
+	perm := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		perm |= unix.S_ISUID
+	}
+	if mode&fs.ModeSetgid != 0 {
+		perm |= unix.S_ISGID
+	}
+	if mode&fs.ModeSticky != 0 {
+		perm |= unix.S_ISVTX
+	}
+	return x.at("chmod", name, func(dirfd int, base string) error {
+		var st unix.Stat_t
+		if err := unix.Fstatat(dirfd, base, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return err
+		}
+		if st.Mode&unix.S_IFMT != unix.S_IFLNK {
+			return unix.Fchmodat(dirfd, base, perm, 0)
+		}
+		// a directory entry extracted on an existing symlink, which is resolved beneath dst
+		fd, err := x.openDir(name)
+		if errors.Is(err, unix.EXDEV) {
+			return ErrUnsafePath
+		}
+		if err != nil {
+			return err
+		}
+		defer func() { _ = unix.Close(fd) }()
+		return unix.Fchmodat(fd, ".", perm, 0)
+	})
+}
+
+func (x *beneathExtractor) lchtimes(name string, atime, mtime time.Time) error {
+	ts := []unix.Timespec{unix.NsecToTimespec(atime.UnixNano()), unix.NsecToTimespec(mtime.UnixNano())}
+	return x.at("utimensat", name, func(dirfd int, base string) error {
+		return unix.UtimesNanoAt(dirfd, base, ts, unix.AT_SYMLINK_NOFOLLOW)
+	})
+}
+
+func (x *beneathExtractor) close() error {
+	return unix.Close(x.fd)
+}
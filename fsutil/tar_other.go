@@ -0,0 +1,7 @@
+//go:build !linux
+
+package fsutil
+
+func newExtractor(dst string) (extractor, error) {
+	return newRootExtractor(dst)
+}
@@ -0,0 +1,103 @@
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shipengqi/golib/sysutil"
+)
+
+// rootExtractor resolves the names with os.Root.
+type rootExtractor struct {
+	root *os.Root
+}
+
+func newRootExtractor(dst string) (*rootExtractor, error) {
+	root, err := os.OpenRoot(dst)
+	if err != nil {
+		return nil, err
+	}
+	return &rootExtractor{root: root}, nil
+}
+
+func (x *rootExtractor) mkdirAll(name string, perm fs.FileMode) error {
+	return x.root.MkdirAll(filepath.FromSlash(name), perm)
+}
+
+// remove removes an existing file or symlink.
+func (x *rootExtractor) remove(name string) error {
+	info, err := x.root.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &fs.PathError{Op: "untar", Path: name, Err: fs.ErrExist}
+	}
+	return x.root.Remove(name)
+}
+
+func (x *rootExtractor) create(name string, perm fs.FileMode) (*os.File, error) {
+	name = filepath.FromSlash(name)
+	if err := x.remove(name); err != nil {
+		return nil, err
+	}
+	return x.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+}
+
+func (x *rootExtractor) symlink(target, name string) error {
+	name = filepath.FromSlash(name)
+	if err := x.remove(name); err != nil {
+		return err
+	}
+	return x.root.Symlink(filepath.FromSlash(target), name)
+}
+
+func (x *rootExtractor) link(oldname, name string) error {
+	name = filepath.FromSlash(name)
+	if err := x.remove(name); err != nil {
+		return err
+	}
+	return x.root.Link(filepath.FromSlash(oldname), name)
+}
+
+func (x *rootExtractor) lmode(name string) (fs.FileMode, error) {
+	info, err := x.root.Lstat(filepath.FromSlash(name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Mode().Type(), nil
+}
+
+func (x *rootExtractor) lchown(name string, uid, gid int) error {
+	if sysutil.IsWindows() {
+		return nil
+	}
+	return x.root.Lchown(filepath.FromSlash(name), uid, gid)
+}
+
+func (x *rootExtractor) chmod(name string, mode fs.FileMode) error {
+	return x.root.Chmod(filepath.FromSlash(name), mode)
+}
+
+func (x *rootExtractor) lchtimes(name string, atime, mtime time.Time) error {
+	name = filepath.FromSlash(name)
+	info, err := x.root.Lstat(name)
+	if err != nil {
+		return err
+	}
+	// os.Root cannot change the times of a symlink
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return nil
+	}
+	return x.root.Chtimes(name, atime, mtime)
+}
+
+func (x *rootExtractor) close() error {
+	return x.root.Close()
+}
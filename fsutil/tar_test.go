@@ -1,8 +1,16 @@
 package fsutil
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -71,3 +79,216 @@ func TestCompress(t *testing.T) {
 	err = DeCompress(unsrc, undst)
 	assert.NoError(t, err)
 }
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+	mode     int64
+	modTime  time.Time
+	uid      int
+}
+
+func writeTar(t *testing.T, compress bool, entries ...tarEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gw *gzip.Writer
+	if compress {
+		gw = gzip.NewWriter(&buf)
+		w = gw
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     e.mode,
+			Size:     int64(len(e.content)),
+			ModTime:  e.modTime,
+			Uid:      e.uid,
+			Gid:      e.uid,
+		}
+		if header.Typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+		}
+		if header.Mode == 0 {
+			header.Mode = 0o644
+		}
+		if header.Typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		assert.NoError(t, tw.WriteHeader(header))
+		_, err := tw.Write([]byte(e.content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	if gw != nil {
+		assert.NoError(t, gw.Close())
+	}
+	fpath := filepath.Join(t.TempDir(), "archive.tar")
+	assert.NoError(t, os.WriteFile(fpath, buf.Bytes(), 0o644))
+	return fpath
+}
+
+func TestUnTarUnsafe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{"parent", []tarEntry{{name: "../evil.txt"}}},
+		{"nested parent", []tarEntry{{name: "a/../../evil.txt"}}},
+		{"absolute symlink", []tarEntry{{name: "link", typeflag: tar.TypeSymlink, linkname: "/etc"}}},
+		{"relative symlink", []tarEntry{{name: "a/link", typeflag: tar.TypeSymlink, linkname: "../../etc"}}},
+		{"hardlink", []tarEntry{{name: "link", typeflag: tar.TypeLink, linkname: "../evil.txt"}}},
+		{"hardlink to symlink", []tarEntry{
+			{name: "a/link", typeflag: tar.TypeSymlink, linkname: "../b"},
+			{name: "hard", typeflag: tar.TypeLink, linkname: "a/link"},
+		}},
+		{"existing symlink", []tarEntry{{name: "out/evil.txt"}}},
+		{"symlink in parent", []tarEntry{
+			{name: "a", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "a/b", typeflag: tar.TypeSymlink, linkname: "../outside"},
+		}},
+		{"parent after symlink", []tarEntry{
+			{name: "a", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "b", typeflag: tar.TypeSymlink, linkname: "a/.."},
+		}},
+		{"parent after missing directory", []tarEntry{
+			{name: "b", typeflag: tar.TypeSymlink, linkname: "a/.."},
+			{name: "a", typeflag: tar.TypeSymlink, linkname: "."},
+		}},
+	}
+	for _, v := range tests {
+		t.Run(v.name, func(t *testing.T) {
+			outside := t.TempDir()
+			dst := filepath.Join(t.TempDir(), "dst")
+			assert.NoError(t, os.MkdirAll(dst, 0o755))
+			assert.NoError(t, os.Symlink(outside, filepath.Join(dst, "out")))
+
+			err := UnTar(writeTar(t, false, v.entries...), dst)
+			assert.ErrorIs(t, err, ErrUnsafePath)
+			entries, err := os.ReadDir(outside)
+			assert.NoError(t, err)
+			assert.Empty(t, entries)
+			assert.False(t, IsExists(filepath.Join(filepath.Dir(dst), "evil.txt")))
+		})
+	}
+
+	t.Run("extractors", func(t *testing.T) {
+		constructors := map[string]func(string) (extractor, error){
+			"default": newExtractor,
+			"root": func(dst string) (extractor, error) {
+				return newRootExtractor(dst)
+			},
+		}
+		for name, newX := range constructors {
+			outside := t.TempDir()
+			dst := t.TempDir()
+			assert.NoError(t, os.Symlink(outside, filepath.Join(dst, "out")))
+			x, err := newX(dst)
+			assert.NoError(t, err, name)
+			_, err = x.create("out/evil.txt", 0o644)
+			assert.Error(t, err, name)
+			assert.Error(t, x.mkdirAll("out/sub", 0o755), name)
+			assert.Error(t, x.symlink("target", "out/link"), name)
+
+			u := &untarrer{x: x}
+			assert.NoError(t, x.mkdirAll("dir", 0o755), name)
+			assert.NoError(t, x.symlink(".", "a"), name)
+			assert.ErrorIs(t, u.checkSymlink("a/b", "../outside"), ErrUnsafePath, name)
+			assert.ErrorIs(t, u.checkSymlink("b", "a/.."), ErrUnsafePath, name)
+			assert.NoError(t, u.checkSymlink("dir/b", "../a/dir"), name)
+			assert.NoError(t, u.checkSymlink("b", "dir/../a"), name)
+			assert.NoError(t, x.close())
+			entries, err := os.ReadDir(outside)
+			assert.NoError(t, err)
+			assert.Empty(t, entries, name)
+		}
+	})
+}
+
+func TestUnTarEntries(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	archive := writeTar(t, true,
+		tarEntry{name: "./", typeflag: tar.TypeDir, mode: 0o755},
+		tarEntry{name: "/abs/a.txt", content: "a"},
+		tarEntry{name: "dir", typeflag: tar.TypeDir, mode: 0o750, modTime: mtime},
+		tarEntry{name: "dir/exec.sh", content: "#!/bin/sh", mode: 0o4751, modTime: mtime},
+		tarEntry{name: "dir/link", typeflag: tar.TypeSymlink, linkname: "exec.sh"},
+		tarEntry{name: "up", typeflag: tar.TypeSymlink, linkname: "dir/../abs"},
+		tarEntry{name: "hard.sh", typeflag: tar.TypeLink, linkname: "dir/exec.sh"},
+		tarEntry{name: "fifo", typeflag: tar.TypeFifo},
+		// replaces the existing file
+		tarEntry{name: "abs/a.txt", content: "replaced"},
+	)
+
+	t.Run("default", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "dst")
+		assert.NoError(t, DeCompress(archive, dst))
+		assert.Equal(t, []string{"abs", "abs/a.txt", "dir", "dir/exec.sh", "dir/link", "hard.sh", "up"}, listTree(t, dst))
+
+		data, err := os.ReadFile(filepath.Join(dst, "abs", "a.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "replaced", string(data))
+		target, err := os.Readlink(filepath.Join(dst, "dir", "link"))
+		assert.NoError(t, err)
+		assert.Equal(t, "exec.sh", target)
+		data, err = os.ReadFile(filepath.Join(dst, "up", "a.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "replaced", string(data))
+
+		a, err := os.Stat(filepath.Join(dst, "dir", "exec.sh"))
+		assert.NoError(t, err)
+		b, err := os.Stat(filepath.Join(dst, "hard.sh"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(a, b))
+		assert.Zero(t, a.Mode()&os.ModeSetuid)
+		assert.NotEqual(t, mtime, a.ModTime().UTC())
+	})
+
+	t.Run("preserve", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "dst")
+		assert.NoError(t, DeCompressWithOptions(archive, dst, UnTarOptions{PreserveMode: true, PreserveTimes: true}))
+
+		info, err := os.Stat(filepath.Join(dst, "dir", "exec.sh"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o751)|os.ModeSetuid, info.Mode())
+		assert.Equal(t, mtime, info.ModTime().UTC())
+
+		info, err = os.Stat(filepath.Join(dst, "dir"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+		assert.Equal(t, mtime, info.ModTime().UTC())
+	})
+}
+
+func TestUnTarLimits(t *testing.T) {
+	archive := writeTar(t, false,
+		tarEntry{name: "a.txt", content: "aaaa"},
+		tarEntry{name: "b.txt", content: "bbbb"},
+		tarEntry{name: "c.txt", content: "cccc"},
+	)
+	assert.NoError(t, UnTarWithOptions(archive, t.TempDir(), UnTarOptions{MaxFiles: 3, MaxSize: 12, MaxRatio: 1}))
+	err := UnTarWithOptions(archive, t.TempDir(), UnTarOptions{MaxFiles: 2})
+	assert.ErrorIs(t, err, ErrArchiveLimit)
+	err = UnTarWithOptions(archive, t.TempDir(), UnTarOptions{MaxSize: 10})
+	assert.ErrorIs(t, err, ErrArchiveLimit)
+
+	bomb := writeTar(t, true, tarEntry{name: "zeros", content: strings.Repeat("\x00", 10<<20)})
+	dst := t.TempDir()
+	err = DeCompressWithOptions(bomb, dst, UnTarOptions{MaxRatio: 100})
+	assert.ErrorIs(t, err, ErrArchiveLimit)
+	size, err := DirSize(dst)
+	assert.NoError(t, err)
+	assert.Less(t, size, int64(10<<20))
+	assert.NoError(t, DeCompress(bomb, t.TempDir()))
+}
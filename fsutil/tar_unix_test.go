@@ -0,0 +1,31 @@
+//go:build linux || darwin
+
+package fsutil
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnTarOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	dst := filepath.Join(t.TempDir(), "dst")
+	archive := writeTar(t, false,
+		tarEntry{name: "a.txt", content: "a", uid: 1234},
+		tarEntry{name: "link", typeflag: tar.TypeSymlink, linkname: "a.txt", uid: 4321},
+	)
+	assert.NoError(t, UnTarWithOptions(archive, dst, UnTarOptions{PreserveOwner: true}))
+	info, err := os.Lstat(filepath.Join(dst, "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1234), info.Sys().(*syscall.Stat_t).Uid)
+	info, err = os.Lstat(filepath.Join(dst, "link"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(4321), info.Sys().(*syscall.Stat_t).Uid)
+}
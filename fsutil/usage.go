@@ -0,0 +1,171 @@
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// DirSizeOptions configures DirSizeWithOptions.
+type DirSizeOptions struct {
+	// Allocated counts the disk blocks allocated to the files instead of their
+	// apparent size, sparse files are smaller and small files are larger. It is
+	// the apparent size on Windows.
+	Allocated bool
+	// Workers is the number of directories read concurrently, defaults to the number of CPUs.
+	Workers int
+}
+
+// DiskStat is the usage of a filesystem.
+type DiskStat struct {
+	// Total is the size of the filesystem in bytes.
+	Total uint64
+	// Free is the number of free bytes.
+	Free uint64
+	// Available is the number of bytes available to unprivileged users.
+	Available uint64
+	// Inodes is the number of inodes, zero if the filesystem does not report it.
+	Inodes uint64
+	// InodesFree is the number of free inodes.
+	InodesFree uint64
+}
+
+// Used returns the number of used bytes.
+func (s *DiskStat) Used() uint64 {
+	return s.Total - s.Free
+}
+
+// DiskUsage returns the usage of the filesystem that contains the given path.
+func DiskUsage(fpath string) (*DiskStat, error) {
+	return diskUsage(fpath)
+}
+
+// DirSize returns the apparent size of the files and symlinks under the given path,
+// the directories are not counted. The files linked several times are counted once.
+func DirSize(fpath string) (int64, error) {
+	return DirSizeWithOptions(fpath, DirSizeOptions{})
+}
+
+// DirSizeWithOptions is like DirSize with the given options.
+func DirSizeWithOptions(fpath string, opts DirSizeOptions) (int64, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	info, err := os.Lstat(fpath)
+	if err != nil {
+		return 0, err
+	}
+	s := &sizer{
+		opts:  opts,
+		links: make(map[fileID]struct{}),
+	}
+	if !info.IsDir() {
+		s.add(info)
+		return s.total, nil
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.queue = []string{fpath}
+	s.pending = 1
+	var wg sync.WaitGroup
+	for range opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work()
+		}()
+	}
+	wg.Wait()
+	return s.total, errors.Join(s.errs...)
+}
+
+// sizer reads the queued directories with a fixed number of workers.
+type sizer struct {
+	opts DirSizeOptions
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []string
+	pending int // the directories queued or being read
+	total   int64
+	links   map[fileID]struct{}
+	errs    []error
+}
+
+// work reads the queued directories until all of them are read.
+func (s *sizer) work() {
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && s.pending > 0 {
+			s.cond.Wait()
+		}
+		if s.pending == 0 {
+			s.mu.Unlock()
+			return
+		}
+		fpath := s.queue[len(s.queue)-1]
+		s.queue = s.queue[:len(s.queue)-1]
+		s.mu.Unlock()
+
+		dirs := s.dir(fpath)
+
+		s.mu.Lock()
+		s.queue = append(s.queue, dirs...)
+		s.pending += len(dirs) - 1
+		s.mu.Unlock()
+		s.cond.Broadcast()
+	}
+}
+
+// dir adds the size of the files in the directory, and returns its subdirectories.
+func (s *sizer) dir(fpath string) []string {
+	entries, err := os.ReadDir(fpath)
+	if err != nil {
+		s.error(err)
+		return nil
+	}
+	var dirs []string
+	for _, entry := range entries {
+		child := filepath.Join(fpath, entry.Name())
+		if entry.IsDir() {
+			dirs = append(dirs, child)
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed after it was listed
+			continue
+		}
+		if err != nil {
+			s.error(err)
+			continue
+		}
+		s.add(info)
+	}
+	return dirs
+}
+
+func (s *sizer) add(info fs.FileInfo) {
+	size := info.Size()
+	if s.opts.Allocated {
+		size = allocatedSize(info)
+	}
+	id, linked := hardlinkID(info)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if linked {
+		if _, ok := s.links[id]; ok {
+			return
+		}
+		s.links[id] = struct{}{}
+	}
+	s.total += size
+}
+
+func (s *sizer) error(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, err)
+}
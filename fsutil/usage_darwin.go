@@ -0,0 +1,8 @@
+package fsutil
+
+import "golang.org/x/sys/unix"
+
+// statfsBlockSize returns the unit of the block counts.
+func statfsBlockSize(st *unix.Statfs_t) uint64 {
+	return uint64(st.Bsize)
+}
@@ -0,0 +1,9 @@
+package fsutil
+
+import "golang.org/x/sys/unix"
+
+// statfsBlockSize returns the unit of the block counts, which is the fragment
+// size on Linux.
+func statfsBlockSize(st *unix.Statfs_t) uint64 {
+	return uint64(st.Frsize)
+}
@@ -0,0 +1,95 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirSize(t *testing.T) {
+	root := t.TempDir()
+	for name, size := range map[string]int{
+		"a.txt":           100,
+		"sub/b.txt":       200,
+		"sub/deep/c.txt":  300,
+		"other/empty.txt": 0,
+	} {
+		fp := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fp), 0o755))
+		assert.NoError(t, os.WriteFile(fp, make([]byte, size), 0o644))
+	}
+
+	size, err := DirSize(root)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(600), size)
+
+	size, err = DirSizeWithOptions(root, DirSizeOptions{Workers: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(600), size)
+
+	size, err = DirSizeWithOptions(root, DirSizeOptions{Workers: 64})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(600), size)
+
+	size, err = DirSize(filepath.Join(root, "sub", "b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), size)
+
+	_, err = DirSize(filepath.Join(root, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	t.Run("hardlinks", func(t *testing.T) {
+		assert.NoError(t, os.Link(filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "a.link")))
+		assert.NoError(t, os.Symlink("a.txt", filepath.Join(root, "a.symlink")))
+		size, err := DirSize(root)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(600+len("a.txt")), size)
+	})
+
+	t.Run("allocated", func(t *testing.T) {
+		sparse := filepath.Join(t.TempDir(), "sparse")
+		fd, err := os.Create(sparse)
+		assert.NoError(t, err)
+		assert.NoError(t, fd.Truncate(64<<20))
+		assert.NoError(t, fd.Close())
+
+		size, err := DirSize(filepath.Dir(sparse))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(64<<20), size)
+		size, err = DirSizeWithOptions(filepath.Dir(sparse), DirSizeOptions{Allocated: true})
+		assert.NoError(t, err)
+		assert.Less(t, size, int64(64<<20))
+	})
+}
+
+func TestDirSizeManyDirs(t *testing.T) {
+	root := t.TempDir()
+	for i := range 200 {
+		fp := filepath.Join(root, strconv.Itoa(i%10), strconv.Itoa(i), "f.txt")
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fp), 0o755))
+		assert.NoError(t, os.WriteFile(fp, make([]byte, i), 0o644))
+	}
+	size, err := DirSizeWithOptions(root, DirSizeOptions{Workers: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200*199/2), size)
+}
+
+func TestDiskUsage(t *testing.T) {
+	stat, err := DiskUsage(t.TempDir())
+	assert.NoError(t, err)
+	assert.Positive(t, stat.Total)
+	assert.LessOrEqual(t, stat.Free, stat.Total)
+	assert.LessOrEqual(t, stat.Available, stat.Free)
+	assert.Equal(t, stat.Total-stat.Free, stat.Used())
+	assert.LessOrEqual(t, stat.InodesFree, stat.Inodes)
+
+	_, err = DiskUsage(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
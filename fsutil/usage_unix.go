@@ -0,0 +1,48 @@
+//go:build linux || darwin
+
+package fsutil
+
+import (
+	"io/fs"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardlinkID returns the identity of a file that has several links.
+func hardlinkID(info fs.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || info.IsDir() || stat.Nlink < 2 {
+		return fileID{}, false
+	}
+	// Dev is an int32 on darwin
+	return fileID{dev: uint64(stat.Dev), ino: stat.Ino}, true
+}
+
+func allocatedSize(info fs.FileInfo) int64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		// st_blocks is always in 512-byte units
+		return stat.Blocks * 512
+	}
+	return info.Size()
+}
+
+func diskUsage(fpath string) (*DiskStat, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(fpath, &st); err != nil {
+		return nil, &fs.PathError{Op: "statfs", Path: fpath, Err: err}
+	}
+	bsize := statfsBlockSize(&st)
+	return &DiskStat{
+		Total:      st.Blocks * bsize,
+		Free:       st.Bfree * bsize,
+		Available:  st.Bavail * bsize,
+		Inodes:     st.Files,
+		InodesFree: st.Ffree,
+	}, nil
+}
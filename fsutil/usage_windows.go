@@ -0,0 +1,31 @@
+package fsutil
+
+import (
+	"io/fs"
+
+	"golang.org/x/sys/windows"
+)
+
+type fileID struct{}
+
+// hardlinkID does not detect hard links on Windows, since fs.FileInfo does not
+// carry the file index.
+func hardlinkID(fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+func allocatedSize(info fs.FileInfo) int64 {
+	return info.Size()
+}
+
+func diskUsage(fpath string) (*DiskStat, error) {
+	p, err := windows.UTF16PtrFromString(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var st DiskStat
+	if err = windows.GetDiskFreeSpaceEx(p, &st.Available, &st.Total, &st.Free); err != nil {
+		return nil, &fs.PathError{Op: "GetDiskFreeSpaceEx", Path: fpath, Err: err}
+	}
+	return &st, nil
+}
@@ -0,0 +1,368 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shipengqi/golib/timeutil"
+)
+
+// ErrEventOverflow is reported by Watch when the kernel event queue overflowed,
+// some events were lost.
+var ErrEventOverflow = errors.New("fsutil: watch event queue overflow")
+
+// defaultPollInterval is the default interval of the polling watcher.
+const defaultPollInterval = time.Second
+
+// Op describes a set of file operations.
+type Op uint32
+
+const (
+	// Create is a new file or directory, or one moved into a watched directory.
+	Create Op = 1 << iota
+	// Write is a change of the file content.
+	Write
+	// Remove is a removed file or directory.
+	Remove
+	// Rename is a file or directory moved away, the polling watcher reports it as Remove.
+	Rename
+	// Chmod is a change of the file attributes.
+	Chmod
+)
+
+var opNames = []struct {
+	op   Op
+	name string
+}{
+	{Create, "CREATE"},
+	{Write, "WRITE"},
+	{Remove, "REMOVE"},
+	{Rename, "RENAME"},
+	{Chmod, "CHMOD"},
+}
+
+// Has reports whether op contains o.
+func (op Op) Has(o Op) bool {
+	return op&o != 0
+}
+
+func (op Op) String() string {
+	var names []string
+	for _, v := range opNames {
+		if op.Has(v.op) {
+			names = append(names, v.name)
+		}
+	}
+	if len(names) == 0 {
+		return "[no events]"
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a file operation reported by Watch.
+type Event struct {
+	Path string
+	Op   Op
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Path
+}
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Recursive watches the subdirectories of the watched directories, including
+	// the ones created later.
+	Recursive bool
+	// Debounce merges the operations of the same path until no event happened on
+	// that path for the duration, zero delivers every event.
+	Debounce time.Duration
+	// Poll uses the polling watcher even if a native one is available.
+	Poll bool
+	// PollInterval is the interval between two scans of the polling watcher, defaults to 1s.
+	PollInterval time.Duration
+	// OnError is called with the errors that happen while watching, such as ErrEventOverflow.
+	OnError func(err error)
+	// Clock is used by the polling watcher and the debounce, defaults to timeutil.RealClock.
+	Clock timeutil.Clock
+}
+
+// Watch watches the given files and directories, and sends the events on the returned
+// channel until ctx is done, the channel is closed then. The children of a watched
+// directory are watched, not its subdirectories unless opts.Recursive is set.
+// It uses inotify on Linux, and a polling watcher that compares the file size,
+// modification time and mode elsewhere. The paths must exist, watch the parent
+// directory of a file that may be replaced, such as a config file written atomically.
+func Watch(ctx context.Context, paths []string, opts WatchOptions) (<-chan Event, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("fsutil: no paths to watch")
+	}
+	if opts.Clock == nil {
+		opts.Clock = timeutil.RealClock()
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	var (
+		w   watcher
+		err error
+	)
+	if opts.Poll {
+		w, err = newPoller(paths, opts)
+	} else {
+		w, err = newNativeWatcher(paths, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		w.run(ctx, events)
+	}()
+	if opts.Debounce <= 0 {
+		return events, nil
+	}
+	debounced := make(chan Event)
+	go func() {
+		defer close(debounced)
+		debounce(ctx, opts.Clock, opts.Debounce, events, debounced)
+	}()
+	return debounced, nil
+}
+
+type watcher interface {
+	// run sends the events on out until ctx is done.
+	run(ctx context.Context, out chan<- Event)
+}
+
+func send(ctx context.Context, out chan<- Event, e Event) bool {
+	select {
+	case out <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// debounce merges the events of each path until no event happened on that path
+// for d, a busy path does not delay the events of the other paths.
+func debounce(ctx context.Context, clock timeutil.Clock, d time.Duration, in <-chan Event, out chan<- Event) {
+	type pendingOp struct {
+		op       Op
+		deadline time.Time
+	}
+	var (
+		order   []string
+		pending = make(map[string]*pendingOp)
+		timer   timeutil.Timer
+		fire    <-chan time.Time
+		armed   bool
+	)
+	for {
+		select {
+		case e, ok := <-in:
+			if !ok {
+				return
+			}
+			p, ok := pending[e.Path]
+			if !ok {
+				p = &pendingOp{}
+				pending[e.Path] = p
+				order = append(order, e.Path)
+			}
+			p.op |= e.Op
+			p.deadline = clock.Now().Add(d)
+			// the timer fires at the earliest deadline, which is not later than this one
+			if timer == nil {
+				timer = clock.NewTimer(d)
+				fire = timer.C()
+			} else if !armed {
+				timer.Reset(d)
+			}
+			armed = true
+		case now := <-fire:
+			armed = false
+			var next time.Time
+			waiting := order[:0]
+			for _, fpath := range order {
+				p := pending[fpath]
+				if p.deadline.After(now) {
+					waiting = append(waiting, fpath)
+					if next.IsZero() || p.deadline.Before(next) {
+						next = p.deadline
+					}
+					continue
+				}
+				delete(pending, fpath)
+				if !send(ctx, out, Event{Path: fpath, Op: p.op}) {
+					return
+				}
+			}
+			clear(order[len(waiting):])
+			order = waiting
+			if len(order) > 0 {
+				timer.Reset(next.Sub(now))
+				armed = true
+			}
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+	}
+}
+
+type fileState struct {
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+}
+
+// poller scans the watched paths at every interval and reports the differences.
+type poller struct {
+	paths []string
+	opts  WatchOptions
+	files map[string]fileState
+}
+
+func newPoller(paths []string, opts WatchOptions) (*poller, error) {
+	for _, fpath := range paths {
+		if _, err := os.Lstat(fpath); err != nil {
+			return nil, err
+		}
+	}
+	p := &poller{paths: paths, opts: opts}
+	files, err := p.scan()
+	if err != nil {
+		return nil, err
+	}
+	p.files = files
+	return p, nil
+}
+
+func (p *poller) run(ctx context.Context, out chan<- Event) {
+	for {
+		select {
+		case <-p.opts.Clock.After(p.opts.PollInterval):
+		case <-ctx.Done():
+			return
+		}
+		files, err := p.scan()
+		if err != nil {
+			if p.opts.OnError != nil {
+				p.opts.OnError(err)
+			}
+			continue
+		}
+		for _, e := range p.diff(files) {
+			if !send(ctx, out, e) {
+				return
+			}
+		}
+		p.files = files
+	}
+}
+
+func (p *poller) diff(files map[string]fileState) []Event {
+	var events []Event
+	for fpath, state := range files {
+		old, ok := p.files[fpath]
+		switch {
+		case !ok || old.mode.Type() != state.mode.Type():
+			events = append(events, Event{Path: fpath, Op: Create})
+		default:
+			var op Op
+			if !state.mode.IsDir() && (old.size != state.size || !old.modTime.Equal(state.modTime)) {
+				op |= Write
+			}
+			if old.mode.Perm() != state.mode.Perm() {
+				op |= Chmod
+			}
+			if op != 0 {
+				events = append(events, Event{Path: fpath, Op: op})
+			}
+		}
+	}
+	for fpath := range p.files {
+		if _, ok := files[fpath]; !ok {
+			events = append(events, Event{Path: fpath, Op: Remove})
+		}
+	}
+	// a parent is created before and removed after its children
+	sortEvents(events)
+	return events
+}
+
+// scan returns the states of the watched paths and their children, a watched
+// path removed after Watch is not an error, so that it is reported when it is created again.
+func (p *poller) scan() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	for _, root := range p.paths {
+		info, err := os.Lstat(root)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[root] = fileState{mode: info.Mode(), size: info.Size(), modTime: info.ModTime()}
+		if !info.IsDir() {
+			continue
+		}
+		err = filepath.WalkDir(root, func(fpath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// the entry was removed during the scan
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if fpath == root {
+				return nil
+			}
+			info, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			files[fpath] = fileState{mode: info.Mode(), size: info.Size(), modTime: info.ModTime()}
+			if d.IsDir() && !p.opts.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// sortEvents sorts the events by path, except the removals that are sorted
+// in reverse order after the others.
+func sortEvents(events []Event) {
+	slices.SortFunc(events, func(a, b Event) int {
+		ar, br := a.Op == Remove, b.Op == Remove
+		switch {
+		case ar && !br:
+			return 1
+		case !ar && br:
+			return -1
+		case ar:
+			return strings.Compare(b.Path, a.Path)
+		default:
+			return strings.Compare(a.Path, b.Path)
+		}
+	})
+}
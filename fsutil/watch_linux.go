@@ -0,0 +1,202 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_DELETE | unix.IN_DELETE_SELF |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_MOVE_SELF | unix.IN_ATTRIB
+
+// inotifyWatcher watches the paths with inotify(7).
+type inotifyWatcher struct {
+	fd      int
+	file    *os.File
+	opts    WatchOptions
+	roots   map[string]bool
+	watches map[int]string
+}
+
+func newNativeWatcher(paths []string, opts WatchOptions) (watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{
+		fd:      fd,
+		opts:    opts,
+		roots:   make(map[string]bool),
+		watches: make(map[int]string),
+	}
+	// the non-blocking fd is added to the runtime poller, so that
+	// closing the file interrupts a pending read.
+	w.file = os.NewFile(uintptr(fd), "inotify")
+	for _, fpath := range paths {
+		fpath = filepath.Clean(fpath)
+		w.roots[fpath] = true
+		if err = w.add(fpath, nil); err != nil {
+			_ = w.file.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// add watches fpath and its subdirectories in recursive mode, found is called
+// for each child found in the new subdirectories.
+func (w *inotifyWatcher) add(fpath string, found func(fpath string)) error {
+	if err := w.addWatch(fpath); err != nil {
+		return err
+	}
+	info, err := os.Lstat(fpath)
+	if err != nil || !info.IsDir() || !w.opts.Recursive {
+		return err
+	}
+	return filepath.WalkDir(fpath, func(child string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if child == fpath {
+			return nil
+		}
+		if found != nil {
+			found(child)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err = w.addWatch(child); errors.Is(err, fs.ErrNotExist) {
+			return filepath.SkipDir
+		}
+		return err
+	})
+}
+
+func (w *inotifyWatcher) addWatch(fpath string) error {
+	wd, err := unix.InotifyAddWatch(w.fd, fpath, inotifyMask|unix.IN_DONT_FOLLOW)
+	if err != nil {
+		return &fs.PathError{Op: "inotify_add_watch", Path: fpath, Err: err}
+	}
+	w.watches[wd] = fpath
+	return nil
+}
+
+// removeWatches stops watching fpath and its subdirectories.
+func (w *inotifyWatcher) removeWatches(fpath string) {
+	for wd, watched := range w.watches {
+		if watched == fpath || strings.HasPrefix(watched, fpath+string(filepath.Separator)) {
+			_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watches, wd)
+		}
+	}
+}
+
+func (w *inotifyWatcher) run(ctx context.Context, out chan<- Event) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = w.file.Close()
+	}()
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				w.error(err)
+			}
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(raw.Len)]
+			offset += unix.SizeofInotifyEvent + int(raw.Len)
+			for _, e := range w.handle(raw, strings.TrimRight(string(name), "\x00")) {
+				if !send(ctx, out, e) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// handle converts an inotify event, and updates the watches.
+func (w *inotifyWatcher) handle(raw *unix.InotifyEvent, name string) []Event {
+	mask := raw.Mask
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		w.error(ErrEventOverflow)
+		return nil
+	}
+	watched, ok := w.watches[int(raw.Wd)]
+	if !ok {
+		return nil
+	}
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.watches, int(raw.Wd))
+		return nil
+	}
+	fpath := watched
+	if name != "" {
+		fpath = filepath.Join(watched, name)
+	} else if mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0 && !w.roots[watched] {
+		// the parent directory reports the subdirectories
+		return nil
+	}
+
+	var op Op
+	if mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		op |= Create
+	}
+	if mask&unix.IN_MODIFY != 0 {
+		op |= Write
+	}
+	if mask&(unix.IN_DELETE|unix.IN_DELETE_SELF) != 0 {
+		op |= Remove
+	}
+	if mask&(unix.IN_MOVED_FROM|unix.IN_MOVE_SELF) != 0 {
+		op |= Rename
+	}
+	if mask&unix.IN_ATTRIB != 0 {
+		op |= Chmod
+	}
+	if op == 0 {
+		return nil
+	}
+	events := []Event{{Path: fpath, Op: op}}
+	if !w.opts.Recursive || mask&unix.IN_ISDIR == 0 || name == "" {
+		return events
+	}
+	switch {
+	case op.Has(Create):
+		// the entries created before the watch was added are reported as created
+		err := w.add(fpath, func(child string) {
+			events = append(events, Event{Path: child, Op: Create})
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			w.error(err)
+		}
+	case op.Has(Rename):
+		w.removeWatches(fpath)
+	}
+	return events
+}
+
+func (w *inotifyWatcher) error(err error) {
+	if w.opts.OnError != nil {
+		w.opts.OnError(err)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package fsutil
+
+func newNativeWatcher(paths []string, opts WatchOptions) (watcher, error) {
+	return newPoller(paths, opts)
+}
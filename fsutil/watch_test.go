@@ -0,0 +1,206 @@
+package fsutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shipengqi/golib/timeutil"
+)
+
+// waitEvents receives the events until all the expected ones are received, the
+// ops of the same path are merged.
+func waitEvents(t *testing.T, events <-chan Event, expected map[string]Op) map[string]Op {
+	t.Helper()
+	got := make(map[string]Op)
+	timeout := time.After(5 * time.Second)
+	for {
+		done := true
+		for fpath, op := range expected {
+			if got[fpath]&op != op {
+				done = false
+			}
+		}
+		if done {
+			return got
+		}
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed, got %v, expected %v", got, expected)
+			}
+			got[e.Path] |= e.Op
+		case <-timeout:
+			t.Fatalf("timeout, got %v, expected %v", got, expected)
+		}
+	}
+}
+
+func TestOpString(t *testing.T) {
+	assert.Equal(t, "[no events]", Op(0).String())
+	assert.Equal(t, "CREATE|WRITE", (Create | Write).String())
+	assert.Equal(t, "REMOVE /tmp/a", Event{Path: "/tmp/a", Op: Remove}.String())
+}
+
+func TestWatch(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		name := "native"
+		if poll {
+			name = "poll"
+		}
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			fpath := filepath.Join(root, "a.txt")
+			assert.NoError(t, os.WriteFile(fpath, []byte("a"), 0o644))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			events, err := Watch(ctx, []string{root}, WatchOptions{
+				Recursive:    true,
+				Poll:         poll,
+				PollInterval: 10 * time.Millisecond,
+			})
+			assert.NoError(t, err)
+
+			assert.NoError(t, os.WriteFile(fpath, []byte("changed"), 0o644))
+			waitEvents(t, events, map[string]Op{fpath: Write})
+
+			assert.NoError(t, os.Chmod(fpath, 0o600))
+			waitEvents(t, events, map[string]Op{fpath: Chmod})
+
+			sub := filepath.Join(root, "sub", "deep")
+			assert.NoError(t, os.MkdirAll(sub, 0o755))
+			assert.NoError(t, os.WriteFile(filepath.Join(sub, "b.txt"), []byte("b"), 0o644))
+			waitEvents(t, events, map[string]Op{
+				filepath.Join(root, "sub"):  Create,
+				sub:                         Create,
+				filepath.Join(sub, "b.txt"): Create,
+			})
+
+			assert.NoError(t, os.Remove(fpath))
+			waitEvents(t, events, map[string]Op{fpath: Remove})
+
+			cancel()
+			for range events {
+			}
+		})
+	}
+}
+
+func TestWatchNotRecursive(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		root := t.TempDir()
+		sub := filepath.Join(root, "sub")
+		assert.NoError(t, os.Mkdir(sub, 0o755))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := Watch(ctx, []string{root}, WatchOptions{Poll: poll, PollInterval: 10 * time.Millisecond})
+		assert.NoError(t, err)
+
+		assert.NoError(t, os.WriteFile(filepath.Join(sub, "ignored.txt"), []byte("a"), 0o644))
+		assert.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644))
+		got := waitEvents(t, events, map[string]Op{filepath.Join(root, "a.txt"): Create})
+		assert.NotContains(t, got, filepath.Join(sub, "ignored.txt"))
+		cancel()
+		for range events {
+		}
+	}
+}
+
+func TestWatchPollClock(t *testing.T) {
+	root := t.TempDir()
+	clock := timeutil.NewFakeClock(time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := Watch(ctx, []string{root}, WatchOptions{Poll: true, Clock: clock})
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte("a"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "b.txt"), []byte("b"), 0o644))
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	// the parent is created before its children, the sub directory is not watched
+	assert.Equal(t, Event{Path: filepath.Join(root, "b.txt"), Op: Create}, <-events)
+	assert.Equal(t, Event{Path: filepath.Join(root, "sub"), Op: Create}, <-events)
+
+	assert.NoError(t, os.RemoveAll(filepath.Join(root, "sub")))
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	assert.Equal(t, Event{Path: filepath.Join(root, "sub"), Op: Remove}, <-events)
+}
+
+func TestWatchDebounce(t *testing.T) {
+	root := t.TempDir()
+	fpath := filepath.Join(root, "a.txt")
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := Watch(ctx, []string{root}, WatchOptions{Debounce: 100 * time.Millisecond})
+	assert.NoError(t, err)
+
+	fd, err := os.Create(fpath)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = fd.WriteString("line\n")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, fd.Close())
+
+	select {
+	case e := <-events:
+		assert.Equal(t, fpath, e.Path)
+		assert.Equal(t, Create|Write, e.Op)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %s", e)
+	case <-time.After(300 * time.Millisecond):
+	}
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestDebounceBusyPath(t *testing.T) {
+	clock := timeutil.NewFakeClock(time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in, out := make(chan Event), make(chan Event, 10)
+	go debounce(ctx, clock, 100*time.Millisecond, in, out)
+	// waits until the event is handled before moving the clock
+	write := func(fpath string) {
+		in <- Event{Path: fpath, Op: Write}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	write("app.log")
+	write("config.yaml")
+	// the log is written more often than the debounce duration
+	for i := 0; i < 3; i++ {
+		clock.Advance(60 * time.Millisecond)
+		write("app.log")
+	}
+	assert.Equal(t, Event{Path: "config.yaml", Op: Write}, <-out)
+
+	clock.Advance(60 * time.Millisecond)
+	select {
+	case e := <-out:
+		t.Fatalf("unexpected event %s", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(40 * time.Millisecond)
+	assert.Equal(t, Event{Path: "app.log", Op: Write}, <-out)
+}
+
+func TestWatchErrors(t *testing.T) {
+	_, err := Watch(context.Background(), nil, WatchOptions{})
+	assert.Error(t, err)
+	for _, poll := range []bool{false, true} {
+		_, err = Watch(context.Background(), []string{filepath.Join(t.TempDir(), "missing")}, WatchOptions{Poll: poll})
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
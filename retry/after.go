@@ -0,0 +1,82 @@
+package retry
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryAfterError is implemented by errors that carry a delay provided by the server,
+// such as the Retry-After header of an HTTP 429 or 503 response. The delay overrides
+// the one computed by Backoff for that attempt.
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+// RetryAfter wraps the given err with the delay to wait before the next attempt.
+// RetryAfter returns nil if err is nil.
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, delay: delay}
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+func (e *retryAfterError) RetryAfter() time.Duration {
+	return e.delay
+}
+
+// ParseRetryAfter returns the delay of the Retry-After header of the given response,
+// the header value is either a number of seconds or an HTTP date.
+func ParseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > math.MaxInt64/int64(time.Second) {
+			return math.MaxInt64, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	delay := time.Until(at)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+func retryAfter(err error) (time.Duration, bool) {
+	var aerr RetryAfterError
+	if errors.As(err, &aerr) {
+		return aerr.RetryAfter(), true
+	}
+	return 0, false
+}
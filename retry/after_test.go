@@ -0,0 +1,70 @@
+package retry
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryAfter(t *testing.T) {
+	t.Run("override backoff delay", func(t *testing.T) {
+		var (
+			count int
+			nexts []time.Duration
+		)
+		cause := errors.New("too many requests")
+		err := Times(3).
+			WithInterval(time.Hour).
+			OnRetry(func(_ int, _ error, next time.Duration) {
+				nexts = append(nexts, next)
+			}).
+			Do(func() error {
+				count++
+				return RetryAfter(cause, time.Millisecond)
+			})
+		assert.ErrorIs(t, err, cause)
+		assert.Equal(t, 3, count)
+		assert.Equal(t, []time.Duration{time.Millisecond, time.Millisecond}, nexts)
+	})
+
+	t.Run("wrap nil error", func(t *testing.T) {
+		assert.NoError(t, RetryAfter(nil, time.Second))
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		ok     bool
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"no header", "", false, 0, 0},
+		{"seconds", "120", true, 2 * time.Minute, 2 * time.Minute},
+		{"negative seconds", "-1", false, 0, 0},
+		{"overflowing seconds", "9223372037", true, math.MaxInt64, math.MaxInt64},
+		{"invalid", "soon", false, 0, 0},
+		{"http date", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), true, 58 * time.Second, time.Minute},
+		{"past http date", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), true, 0, 0},
+	}
+
+	for _, v := range tests {
+		t.Run(v.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if v.header != "" {
+				resp.Header.Set("Retry-After", v.header)
+			}
+			got, ok := ParseRetryAfter(resp)
+			assert.Equal(t, v.ok, ok)
+			assert.True(t, got >= v.min && got <= v.max, "got %s", got)
+		})
+	}
+
+	_, ok := ParseRetryAfter(nil)
+	assert.False(t, ok)
+}
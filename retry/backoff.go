@@ -0,0 +1,140 @@
+package retry
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes the delay to wait before the next attempt.
+type Backoff interface {
+	// Next returns the delay after the given failed attempt, attempt starts at 1.
+	// prev is the delay returned for the previous attempt, or zero for the first one.
+	Next(attempt int, prev time.Duration) time.Duration
+}
+
+// BackoffFunc is an adapter to allow the use of ordinary functions as Backoff.
+type BackoffFunc func(attempt int, prev time.Duration) time.Duration
+
+// Next calls f(attempt, prev).
+func (f BackoffFunc) Next(attempt int, prev time.Duration) time.Duration {
+	return f(attempt, prev)
+}
+
+// Constant returns a Backoff that always waits the given interval.
+func Constant(interval time.Duration) Backoff {
+	return BackoffFunc(func(int, time.Duration) time.Duration {
+		return interval
+	})
+}
+
+// Linear returns a Backoff that waits base * attempt, capped at maxDelay.
+// A maxDelay less than or equal to zero means no cap.
+func Linear(base, maxDelay time.Duration) Backoff {
+	return BackoffFunc(func(attempt int, _ time.Duration) time.Duration {
+		if base <= 0 || attempt <= 0 {
+			return 0
+		}
+		if time.Duration(attempt) > math.MaxInt64/base {
+			return capped(math.MaxInt64, maxDelay)
+		}
+		return capped(base*time.Duration(attempt), maxDelay)
+	})
+}
+
+// Fibonacci returns a Backoff that waits base multiplied by the Fibonacci
+// number of the attempt (1, 1, 2, 3, 5, ...), capped at maxDelay.
+// A maxDelay less than or equal to zero means no cap.
+func Fibonacci(base, maxDelay time.Duration) Backoff {
+	return BackoffFunc(func(attempt int, _ time.Duration) time.Duration {
+		if base <= 0 || attempt <= 0 {
+			return 0
+		}
+		a, b := base, base
+		for i := 1; i < attempt; i++ {
+			if reached(a, maxDelay) || b > math.MaxInt64-a {
+				return capped(math.MaxInt64, maxDelay)
+			}
+			a, b = b, a+b
+		}
+		return capped(a, maxDelay)
+	})
+}
+
+// Exponential returns a Backoff that waits base * 2^(attempt-1), capped at maxDelay.
+// A maxDelay less than or equal to zero means no cap.
+func Exponential(base, maxDelay time.Duration) Backoff {
+	return BackoffFunc(func(attempt int, _ time.Duration) time.Duration {
+		return exponential(base, maxDelay, attempt)
+	})
+}
+
+// ExponentialFullJitter returns a Backoff that waits a random duration
+// between zero and the exponential delay.
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func ExponentialFullJitter(base, maxDelay time.Duration) Backoff {
+	return BackoffFunc(func(attempt int, _ time.Duration) time.Duration {
+		return between(0, exponential(base, maxDelay, attempt))
+	})
+}
+
+// ExponentialEqualJitter returns a Backoff that waits half of the exponential
+// delay plus a random duration between zero and the other half.
+func ExponentialEqualJitter(base, maxDelay time.Duration) Backoff {
+	return BackoffFunc(func(attempt int, _ time.Duration) time.Duration {
+		half := exponential(base, maxDelay, attempt) / 2
+		return half + between(0, half)
+	})
+}
+
+// DecorrelatedJitter returns a Backoff that waits a random duration between
+// base and three times the previous delay, capped at maxDelay.
+func DecorrelatedJitter(base, maxDelay time.Duration) Backoff {
+	return BackoffFunc(func(_ int, prev time.Duration) time.Duration {
+		if base <= 0 {
+			return 0
+		}
+		upper := time.Duration(math.MaxInt64)
+		if prev <= math.MaxInt64/3 {
+			upper = max(base, 3*prev)
+		}
+		return capped(between(base, upper), maxDelay)
+	})
+}
+
+func exponential(base, maxDelay time.Duration, attempt int) time.Duration {
+	if base <= 0 || attempt <= 0 {
+		return 0
+	}
+	d := base
+	for i := 1; i < attempt; i++ {
+		if reached(d, maxDelay) || d > math.MaxInt64/2 {
+			return capped(math.MaxInt64, maxDelay)
+		}
+		d *= 2
+	}
+	return capped(d, maxDelay)
+}
+
+// between returns a random duration in [lower, upper].
+func between(lower, upper time.Duration) time.Duration {
+	if upper <= lower {
+		return lower
+	}
+	n := int64(upper - lower)
+	if n == math.MaxInt64 {
+		return lower + time.Duration(rand.Int64N(n))
+	}
+	return lower + time.Duration(rand.Int64N(n+1))
+}
+
+func reached(d, maxDelay time.Duration) bool {
+	return maxDelay > 0 && d >= maxDelay
+}
+
+func capped(d, maxDelay time.Duration) time.Duration {
+	if reached(d, maxDelay) {
+		return maxDelay
+	}
+	return d
+}
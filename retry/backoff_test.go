@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  Backoff
+		expected []time.Duration
+	}{
+		{"constant", Constant(time.Second), []time.Duration{time.Second, time.Second, time.Second}},
+		{"linear", Linear(time.Second, 0), []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+		{"linear with max", Linear(time.Second, 2*time.Second), []time.Duration{time.Second, 2 * time.Second, 2 * time.Second}},
+		{"fibonacci", Fibonacci(time.Second, 0), []time.Duration{time.Second, time.Second, 2 * time.Second, 3 * time.Second, 5 * time.Second}},
+		{"fibonacci with max", Fibonacci(time.Second, 4*time.Second), []time.Duration{time.Second, time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second}},
+		{"exponential", Exponential(time.Second, 0), []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}},
+		{"exponential with max", Exponential(time.Second, 5*time.Second), []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}},
+	}
+
+	for _, v := range tests {
+		t.Run(v.name, func(t *testing.T) {
+			var prev time.Duration
+			for i, expected := range v.expected {
+				prev = v.backoff.Next(i+1, prev)
+				assert.Equal(t, expected, prev, fmt.Sprintf("attempt %d", i+1))
+			}
+		})
+	}
+}
+
+func TestBackoffOverflow(t *testing.T) {
+	assert.Equal(t, time.Duration(math.MaxInt64), Exponential(time.Second, 0).Next(100, 0))
+	assert.Equal(t, time.Minute, Exponential(time.Second, time.Minute).Next(1<<20, 0))
+	assert.Equal(t, time.Duration(math.MaxInt64), Fibonacci(time.Second, 0).Next(200, 0))
+	assert.Equal(t, time.Duration(math.MaxInt64), Linear(time.Hour, 0).Next(math.MaxInt, 0))
+}
+
+func TestJitterBackoff(t *testing.T) {
+	base, maxDelay := 100*time.Millisecond, 2*time.Second
+	full := ExponentialFullJitter(base, maxDelay)
+	equal := ExponentialEqualJitter(base, maxDelay)
+	decorrelated := DecorrelatedJitter(base, maxDelay)
+
+	var prev time.Duration
+	for attempt := 1; attempt <= 10; attempt++ {
+		upper := Exponential(base, maxDelay).Next(attempt, 0)
+
+		d := full.Next(attempt, 0)
+		assert.True(t, d >= 0 && d <= upper, "full jitter %s out of [0, %s]", d, upper)
+
+		d = equal.Next(attempt, 0)
+		assert.True(t, d >= upper/2 && d <= upper, "equal jitter %s out of [%s, %s]", d, upper/2, upper)
+
+		d = decorrelated.Next(attempt, prev)
+		assert.True(t, d >= base && d <= maxDelay, "decorrelated jitter %s out of [%s, %s]", d, base, maxDelay)
+		assert.True(t, d <= max(base, 3*prev), "decorrelated jitter %s exceeds 3 * %s", d, prev)
+		prev = d
+	}
+
+	// starting from base, the delays grow until they reach maxDelay
+	prev = 0
+	grown := false
+	for attempt := 1; attempt <= 100 && !grown; attempt++ {
+		prev = decorrelated.Next(attempt, prev)
+		grown = prev > base
+	}
+	assert.True(t, grown, "decorrelated jitter never exceeds %s", base)
+	assert.Equal(t, maxDelay, DecorrelatedJitter(base, maxDelay).Next(2, time.Duration(math.MaxInt64)))
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	var attempts []int
+	err := Times(4).
+		WithBackoff(BackoffFunc(func(attempt int, _ time.Duration) time.Duration {
+			attempts = append(attempts, attempt)
+			return time.Millisecond
+		})).
+		Do(func() error {
+			return errors.New("test err")
+		})
+	assert.Error(t, err)
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+}
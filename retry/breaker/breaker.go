@@ -0,0 +1,355 @@
+// Package breaker provides a circuit breaker that can be used standalone or
+// along with retry.Retry.
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shipengqi/golib/retry"
+	"github.com/shipengqi/golib/timeutil"
+)
+
+var (
+	// ErrOpen is returned when the circuit breaker is open.
+	ErrOpen = errors.New("breaker: circuit breaker is open")
+	// ErrTooManyProbes is returned when the circuit breaker is half-open
+	// and the probe quota is used up.
+	ErrTooManyProbes = errors.New("breaker: too many probes in half-open state")
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// StateClosed lets all requests through and counts the failures.
+	StateClosed State = iota
+	// StateOpen rejects all requests until the cool-down expires.
+	StateOpen
+	// StateHalfOpen lets a limited number of probes through to
+	// check whether the downstream has recovered.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown state: %d", int(s))
+	}
+}
+
+// Clock provides the current time, timeutil.Clock implements it.
+type Clock interface {
+	Now() time.Time
+}
+
+// Counts holds the numbers of requests and their results in the current state.
+type Counts struct {
+	Requests             int
+	Successes            int
+	Failures             int
+	ConsecutiveSuccesses int
+	ConsecutiveFailures  int
+}
+
+func (c *Counts) onRequest() {
+	c.Requests++
+}
+
+func (c *Counts) onSuccess() {
+	c.Successes++
+	c.ConsecutiveSuccesses++
+	c.ConsecutiveFailures = 0
+}
+
+func (c *Counts) onFailure() {
+	c.Failures++
+	c.ConsecutiveFailures++
+	c.ConsecutiveSuccesses = 0
+}
+
+// TripPolicy reports whether the circuit breaker should trip from closed to open,
+// it is called with the counts of the closed state after each failure.
+type TripPolicy func(counts Counts) bool
+
+// ConsecutiveFailures trips the circuit breaker after n consecutive failures.
+func ConsecutiveFailures(n int) TripPolicy {
+	return func(counts Counts) bool {
+		return counts.ConsecutiveFailures >= n
+	}
+}
+
+// FailureRatio trips the circuit breaker when the ratio of failures reaches ratio,
+// once at least minRequests requests have been made.
+func FailureRatio(ratio float64, minRequests int) TripPolicy {
+	return func(counts Counts) bool {
+		if counts.Requests == 0 || counts.Requests < minRequests {
+			return false
+		}
+		return float64(counts.Failures)/float64(counts.Requests) >= ratio
+	}
+}
+
+// Option configures a Breaker.
+type Option func(b *Breaker)
+
+// WithTripPolicy sets the TripPolicy, defaults to ConsecutiveFailures(5).
+func WithTripPolicy(policy TripPolicy) Option {
+	return func(b *Breaker) {
+		b.trip = policy
+	}
+}
+
+// WithCoolDown sets how long the circuit breaker stays open before it becomes
+// half-open, defaults to 60 seconds.
+func WithCoolDown(d time.Duration) Option {
+	return func(b *Breaker) {
+		b.coolDown = d
+	}
+}
+
+// WithInterval sets the period after which the counts of the closed state are cleared,
+// zero means the counts are only cleared on state change.
+func WithInterval(d time.Duration) Option {
+	return func(b *Breaker) {
+		b.interval = d
+	}
+}
+
+// WithHalfOpenProbes sets the number of probes allowed in half-open state,
+// the circuit breaker closes once all of them succeed. Defaults to 1.
+func WithHalfOpenProbes(n int) Option {
+	return func(b *Breaker) {
+		b.probes = n
+	}
+}
+
+// WithIsFailure sets the predicate that reports whether the given error
+// counts as a failure, defaults to any non-nil error.
+func WithIsFailure(fn func(err error) bool) Option {
+	return func(b *Breaker) {
+		b.isFailure = fn
+	}
+}
+
+// OnStateChange sets the callback called when the state changes. The callback is
+// called with the circuit breaker locked, so it must not call the circuit breaker.
+func OnStateChange(fn func(from, to State)) Option {
+	return func(b *Breaker) {
+		b.onStateChange = fn
+	}
+}
+
+// WithClock sets the Clock, defaults to the wall clock.
+func WithClock(clock Clock) Option {
+	return func(b *Breaker) {
+		b.clock = clock
+	}
+}
+
+// Breaker is a circuit breaker with closed, open and half-open states.
+// It is safe for concurrent use.
+type Breaker struct {
+	trip          TripPolicy
+	coolDown      time.Duration
+	interval      time.Duration
+	probes        int
+	isFailure     func(err error) bool
+	onStateChange func(from, to State)
+	clock         Clock
+
+	mu         sync.Mutex
+	state      State
+	generation uint64
+	counts     Counts
+	expiry     time.Time
+}
+
+// New creates a Breaker with the given options.
+func New(opts ...Option) *Breaker {
+	b := &Breaker{
+		trip:     ConsecutiveFailures(5),
+		coolDown: 60 * time.Second,
+		probes:   1,
+		isFailure: func(err error) bool {
+			return err != nil
+		},
+		clock: timeutil.RealClock(),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.probes < 1 {
+		b.probes = 1
+	}
+	b.toNewGeneration(b.clock.Now())
+	return b
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, _ := b.currentState(b.clock.Now())
+	return state
+}
+
+// Counts returns the counts of the current state.
+func (b *Breaker) Counts() Counts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.currentState(b.clock.Now())
+	return b.counts
+}
+
+// Allow checks whether a request is allowed. If it is, the caller must report the
+// result of the request by calling done exactly once. Otherwise, ErrOpen or
+// ErrTooManyProbes is returned.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, generation := b.currentState(b.clock.Now())
+	if state == StateOpen {
+		return nil, ErrOpen
+	}
+	if state == StateHalfOpen && b.counts.Requests >= b.probes {
+		return nil, ErrTooManyProbes
+	}
+	b.counts.onRequest()
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() {
+			b.done(generation, success)
+		})
+	}, nil
+}
+
+// Execute runs fn if the circuit breaker allows it and records the result.
+func (b *Breaker) Execute(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	success := false
+	defer func() {
+		done(success)
+	}()
+	err = fn()
+	success = !b.isFailure(err)
+	return err
+}
+
+// Do runs the given retry.Retry as a single request of the circuit breaker.
+func (b *Breaker) Do(r *retry.Retry, fn func() error) error {
+	return b.Execute(func() error {
+		return r.Do(fn)
+	})
+}
+
+// Wrap returns a func that runs fn through the circuit breaker, so that each
+// attempt of a retry.Retry is a request of the circuit breaker. The returned func
+// fails with retry.Permanent when the circuit breaker rejects the attempt,
+// which stops the retries.
+func (b *Breaker) Wrap(fn func() error) func() error {
+	return func() error {
+		err := b.Execute(fn)
+		if errors.Is(err, ErrOpen) || errors.Is(err, ErrTooManyProbes) {
+			return retry.Permanent(err)
+		}
+		return err
+	}
+}
+
+func (b *Breaker) done(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	state, current := b.currentState(now)
+	// ignores the results of the requests made before the state changed
+	if generation != current {
+		return
+	}
+	if success {
+		b.onSuccess(state, now)
+	} else {
+		b.onFailure(state, now)
+	}
+}
+
+func (b *Breaker) onSuccess(state State, now time.Time) {
+	b.counts.onSuccess()
+	if state == StateHalfOpen && b.counts.ConsecutiveSuccesses >= b.probes {
+		b.setState(StateClosed, now)
+	}
+}
+
+func (b *Breaker) onFailure(state State, now time.Time) {
+	b.counts.onFailure()
+	switch state {
+	case StateClosed:
+		if b.trip(b.counts) {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		b.setState(StateOpen, now)
+	default:
+	}
+}
+
+func (b *Breaker) currentState(now time.Time) (State, uint64) {
+	switch b.state {
+	case StateClosed:
+		if !b.expiry.IsZero() && !b.expiry.After(now) {
+			b.toNewGeneration(now)
+		}
+	case StateOpen:
+		if !b.expiry.After(now) {
+			b.setState(StateHalfOpen, now)
+		}
+	default:
+	}
+	return b.state, b.generation
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	if b.state == state {
+		return
+	}
+	prev := b.state
+	b.state = state
+	b.toNewGeneration(now)
+	if b.onStateChange != nil {
+		b.onStateChange(prev, state)
+	}
+}
+
+func (b *Breaker) toNewGeneration(now time.Time) {
+	b.generation++
+	b.counts = Counts{}
+
+	var zero time.Time
+	switch b.state {
+	case StateClosed:
+		if b.interval > 0 {
+			b.expiry = now.Add(b.interval)
+		} else {
+			b.expiry = zero
+		}
+	case StateOpen:
+		b.expiry = now.Add(b.coolDown)
+	default:
+		b.expiry = zero
+	}
+}
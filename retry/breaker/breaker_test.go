@@ -0,0 +1,161 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shipengqi/golib/retry"
+	"github.com/shipengqi/golib/timeutil"
+)
+
+var errTest = errors.New("test err")
+
+func fail() error {
+	return errTest
+}
+
+func succeed() error {
+	return nil
+}
+
+func TestBreaker(t *testing.T) {
+	t.Run("trip on consecutive failures", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		var changes []string
+		b := New(
+			WithTripPolicy(ConsecutiveFailures(3)),
+			WithCoolDown(time.Minute),
+			WithClock(clock),
+			OnStateChange(func(from, to State) {
+				changes = append(changes, from.String()+"->"+to.String())
+			}),
+		)
+		assert.Equal(t, StateClosed, b.State())
+
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.NoError(t, b.Execute(succeed))
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.Equal(t, StateClosed, b.State())
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.Equal(t, StateOpen, b.State())
+		assert.ErrorIs(t, b.Execute(succeed), ErrOpen)
+
+		clock.Advance(time.Minute)
+		assert.Equal(t, StateHalfOpen, b.State())
+		assert.NoError(t, b.Execute(succeed))
+		assert.Equal(t, StateClosed, b.State())
+		assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, changes)
+	})
+
+	t.Run("trip on failure ratio", func(t *testing.T) {
+		b := New(WithTripPolicy(FailureRatio(0.5, 4)))
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.Equal(t, StateClosed, b.State())
+		assert.NoError(t, b.Execute(succeed))
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.Equal(t, StateOpen, b.State())
+	})
+
+	t.Run("reopen on half-open failure", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		b := New(WithTripPolicy(ConsecutiveFailures(1)), WithCoolDown(time.Second), WithClock(clock))
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		clock.Advance(time.Second)
+		assert.Equal(t, StateHalfOpen, b.State())
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.Equal(t, StateOpen, b.State())
+		clock.Advance(time.Second - time.Millisecond)
+		assert.Equal(t, StateOpen, b.State())
+	})
+
+	t.Run("half-open probe quota", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		b := New(
+			WithTripPolicy(ConsecutiveFailures(1)),
+			WithCoolDown(time.Second),
+			WithHalfOpenProbes(2),
+			WithClock(clock),
+		)
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		clock.Advance(time.Second)
+
+		done1, err := b.Allow()
+		assert.NoError(t, err)
+		done2, err := b.Allow()
+		assert.NoError(t, err)
+		_, err = b.Allow()
+		assert.ErrorIs(t, err, ErrTooManyProbes)
+
+		done1(true)
+		assert.Equal(t, StateHalfOpen, b.State())
+		done2(true)
+		assert.Equal(t, StateClosed, b.State())
+	})
+
+	t.Run("clear counts after interval", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		b := New(WithTripPolicy(ConsecutiveFailures(2)), WithInterval(time.Minute), WithClock(clock))
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.Equal(t, 1, b.Counts().Failures)
+		clock.Advance(time.Minute)
+		assert.Equal(t, Counts{}, b.Counts())
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.Equal(t, StateClosed, b.State())
+	})
+
+	t.Run("ignore results of previous state", func(t *testing.T) {
+		b := New(WithTripPolicy(ConsecutiveFailures(1)))
+		done, err := b.Allow()
+		assert.NoError(t, err)
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.Equal(t, StateOpen, b.State())
+		done(true)
+		assert.Equal(t, Counts{}, b.Counts())
+	})
+
+	t.Run("is failure", func(t *testing.T) {
+		b := New(
+			WithTripPolicy(ConsecutiveFailures(1)),
+			WithIsFailure(func(err error) bool {
+				return err != nil && !errors.Is(err, errTest)
+			}),
+		)
+		assert.ErrorIs(t, b.Execute(fail), errTest)
+		assert.Equal(t, StateClosed, b.State())
+		assert.Equal(t, 1, b.Counts().Successes)
+	})
+}
+
+func TestBreakerWithRetry(t *testing.T) {
+	t.Run("wrap a retry run", func(t *testing.T) {
+		b := New(WithTripPolicy(ConsecutiveFailures(1)))
+		var count int
+		err := b.Do(retry.Times(3), func() error {
+			count++
+			return errTest
+		})
+		assert.ErrorIs(t, err, errTest)
+		assert.Equal(t, 3, count)
+		assert.Equal(t, StateOpen, b.State())
+
+		err = b.Do(retry.Times(3), succeed)
+		assert.ErrorIs(t, err, ErrOpen)
+	})
+
+	t.Run("wrap each attempt", func(t *testing.T) {
+		b := New(WithTripPolicy(ConsecutiveFailures(2)))
+		var count int
+		err := retry.Times(5).Do(b.Wrap(func() error {
+			count++
+			return errTest
+		}))
+		assert.ErrorIs(t, err, ErrOpen)
+		assert.Equal(t, 2, count)
+	})
+}
@@ -0,0 +1,150 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/shipengqi/golib/timeutil"
+)
+
+// ErrBudgetExhausted is returned along with the last error when a retry is refused by the Budget.
+var ErrBudgetExhausted = errors.New("retry: retry budget exhausted")
+
+// Budget limits the retries shared across the runs of many callers, so that
+// retries do not multiply the load of a dependency during an outage.
+// It must be safe for concurrent use.
+type Budget interface {
+	// Request records a request, it is called for the first attempt of each run.
+	Request()
+	// Withdraw reports whether a retry is allowed, and consumes the budget if it is.
+	Withdraw() bool
+}
+
+// TokenBucketBudget is a Budget backed by a token bucket. Each request deposits
+// tokens into the bucket and each retry withdraws one token.
+type TokenBucketBudget struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	deposit  float64
+}
+
+// NewTokenBucketBudget creates a full TokenBucketBudget with the given capacity,
+// each request deposits the given number of tokens, e.g. 0.1 allows one retry
+// every ten requests once the initial tokens are used up.
+func NewTokenBucketBudget(capacity int, deposit float64) *TokenBucketBudget {
+	return &TokenBucketBudget{
+		tokens:   float64(capacity),
+		capacity: float64(capacity),
+		deposit:  deposit,
+	}
+}
+
+// Request deposits tokens into the bucket.
+func (b *TokenBucketBudget) Request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.capacity, b.tokens+b.deposit)
+}
+
+// Withdraw takes a token from the bucket if there is one.
+func (b *TokenBucketBudget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RatioBudget is a Budget that limits the retries to a ratio of the requests
+// made in a sliding time window.
+type RatioBudget struct {
+	mu         sync.Mutex
+	clock      timeutil.Clock
+	ratio      float64
+	minRetries int
+	width      time.Duration
+	slots      []ratioSlot
+	head       int
+	headStart  time.Time
+}
+
+type ratioSlot struct {
+	requests int
+	retries  int
+}
+
+const ratioBudgetSlots = 10
+
+// NewRatioBudget creates a RatioBudget that allows minRetries plus ratio * requests
+// retries in the given window, e.g. a ratio of 0.2 allows retries to add at most
+// 20% to the load of the dependency.
+func NewRatioBudget(ratio float64, minRetries int, window time.Duration) *RatioBudget {
+	width := window / ratioBudgetSlots
+	if width <= 0 {
+		width = 1
+	}
+	return &RatioBudget{
+		clock:      timeutil.RealClock(),
+		ratio:      ratio,
+		minRetries: minRetries,
+		width:      width,
+		slots:      make([]ratioSlot, ratioBudgetSlots),
+	}
+}
+
+// WithClock sets the Clock used to slide the window, it must be called before use.
+func (b *RatioBudget) WithClock(clock timeutil.Clock) *RatioBudget {
+	b.clock = clock
+	return b
+}
+
+// Request records a request in the current window.
+func (b *RatioBudget) Request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.slide()
+	b.slots[b.head].requests++
+}
+
+// Withdraw reports whether the retries in the current window are still under the limit.
+func (b *RatioBudget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.slide()
+	var requests, retries int
+	for _, s := range b.slots {
+		requests += s.requests
+		retries += s.retries
+	}
+	if float64(retries+1) > float64(b.minRetries)+b.ratio*float64(requests) {
+		return false
+	}
+	b.slots[b.head].retries++
+	return true
+}
+
+// slide drops the slots that are out of the window.
+func (b *RatioBudget) slide() {
+	now := b.clock.Now()
+	if b.headStart.IsZero() {
+		b.headStart = now
+		return
+	}
+	n := int(now.Sub(b.headStart) / b.width)
+	if n <= 0 {
+		return
+	}
+	if n >= len(b.slots) {
+		clear(b.slots)
+	} else {
+		for i := 0; i < n; i++ {
+			b.head = (b.head + 1) % len(b.slots)
+			b.slots[b.head] = ratioSlot{}
+		}
+	}
+	b.headStart = b.headStart.Add(time.Duration(n) * b.width)
+}
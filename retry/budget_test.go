@@ -0,0 +1,96 @@
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shipengqi/golib/timeutil"
+)
+
+func TestTokenBucketBudget(t *testing.T) {
+	b := NewTokenBucketBudget(2, 0.5)
+	assert.True(t, b.Withdraw())
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+
+	b.Request()
+	assert.False(t, b.Withdraw())
+	b.Request()
+	assert.True(t, b.Withdraw())
+
+	// deposits are capped by the capacity
+	for i := 0; i < 10; i++ {
+		b.Request()
+	}
+	assert.True(t, b.Withdraw())
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+}
+
+func TestRatioBudget(t *testing.T) {
+	clock := timeutil.NewFakeClock(time.Now())
+	b := NewRatioBudget(0.5, 1, 10*time.Second).WithClock(clock)
+
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+
+	for i := 0; i < 4; i++ {
+		b.Request()
+	}
+	assert.True(t, b.Withdraw())
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+
+	// the retries and requests slide out of the window
+	clock.Advance(5 * time.Second)
+	assert.False(t, b.Withdraw())
+	clock.Advance(5 * time.Second)
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+}
+
+func TestWithBudget(t *testing.T) {
+	t.Run("stop when the budget is exhausted", func(t *testing.T) {
+		budget := NewTokenBucketBudget(3, 0)
+		policy := Times(3).WithBudget(budget)
+		var count int
+		fail := func() error {
+			count++
+			return errors.New("test err")
+		}
+
+		err := policy.Do(fail)
+		assert.Equal(t, 3, count)
+		assert.Equal(t, "test err", err.Error())
+
+		count = 0
+		err = policy.Do(fail)
+		assert.Equal(t, 2, count)
+		assert.ErrorIs(t, err, ErrBudgetExhausted)
+		assert.Equal(t, "retry: retry budget exhausted: test err", err.Error())
+	})
+
+	t.Run("record requests", func(t *testing.T) {
+		budget := NewTokenBucketBudget(1, 1)
+		assert.True(t, budget.Withdraw())
+		err := Times(3).WithBudget(budget).Do(func() error {
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.True(t, budget.Withdraw())
+	})
+
+	t.Run("hedged mode", func(t *testing.T) {
+		budget := NewTokenBucketBudget(1, 0)
+		var count int
+		err := Times(3).WithHedge(time.Hour).WithBudget(budget).Do(func() error {
+			count++
+			return errors.New("test err")
+		})
+		assert.Equal(t, 2, count)
+		assert.ErrorIs(t, err, ErrBudgetExhausted)
+	})
+}
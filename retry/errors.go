@@ -0,0 +1,93 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Unrecoverable reports an error that should not be retried,
+// use errors.Is(err, Unrecoverable) to check it.
+var Unrecoverable = errors.New("retry: unrecoverable error")
+
+// AttemptError records the error returned by an attempt.
+type AttemptError struct {
+	// Attempt is the attempt number, starts at 1.
+	Attempt int
+	// Time is the time when the attempt failed.
+	Time time.Time
+	Err  error
+}
+
+func (e *AttemptError) Error() string {
+	return fmt.Sprintf("attempt %d: %s", e.Attempt, e.Err)
+}
+
+func (e *AttemptError) Unwrap() error {
+	return e.Err
+}
+
+// Errors is returned by Retry.Do when WithAllErrors is set,
+// it carries the error of every failed attempt in order.
+type Errors []*AttemptError
+
+// Error returns the errors of all attempts, one per line like errors.Join.
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors of all attempts, so errors.Is and errors.As
+// check each of them.
+func (e Errors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Last returns the error of the last attempt, or nil if there is none.
+func (e Errors) Last() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e[len(e)-1].Err
+}
+
+type permanentError struct {
+	err error
+}
+
+// Permanent wraps the given err to stop retrying immediately,
+// Retry.Do returns the original err. Permanent returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func (e *permanentError) Is(target error) bool {
+	return target == Unrecoverable
+}
+
+// unwrapPermanent returns the cause if err is created by Permanent.
+func unwrapPermanent(err error) error {
+	if perr, ok := err.(*permanentError); ok {
+		return perr.err
+	}
+	return err
+}
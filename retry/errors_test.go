@@ -0,0 +1,120 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("not found")
+
+	t.Run("stop on permanent error", func(t *testing.T) {
+		var count int
+		err := Times(5).Do(func() error {
+			count++
+			return Permanent(cause)
+		})
+		assert.Same(t, cause, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("stop on unrecoverable error", func(t *testing.T) {
+		var count int
+		err := Times(5).Do(func() error {
+			count++
+			return fmt.Errorf("validate: %w", Unrecoverable)
+		})
+		assert.ErrorIs(t, err, Unrecoverable)
+		assert.Equal(t, "validate: retry: unrecoverable error", err.Error())
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("permanent error matches cause and unrecoverable", func(t *testing.T) {
+		err := Permanent(cause)
+		assert.ErrorIs(t, err, cause)
+		assert.ErrorIs(t, err, Unrecoverable)
+		assert.Equal(t, cause.Error(), err.Error())
+		assert.NoError(t, Permanent(nil))
+	})
+}
+
+func TestRetryIf(t *testing.T) {
+	retryable := errors.New("retryable")
+	other := errors.New("other")
+
+	var count int
+	err := Times(5).
+		RetryIf(func(err error) bool {
+			return errors.Is(err, retryable)
+		}).
+		Do(func() error {
+			count++
+			if count < 3 {
+				return retryable
+			}
+			return other
+		})
+	assert.Same(t, other, err)
+	assert.Equal(t, 3, count)
+}
+
+type codeError struct {
+	code int
+}
+
+func (e *codeError) Error() string {
+	return fmt.Sprintf("code %d", e.code)
+}
+
+func TestWithAllErrors(t *testing.T) {
+	t.Run("collect errors of all attempts", func(t *testing.T) {
+		var count int
+		start := time.Now()
+		err := Times(3).WithAllErrors().Do(func() error {
+			count++
+			return &codeError{code: count}
+		})
+		assert.Equal(t, "attempt 1: code 1\nattempt 2: code 2\nattempt 3: code 3", err.Error())
+
+		var errs Errors
+		assert.ErrorAs(t, err, &errs)
+		assert.Len(t, errs, 3)
+		for i, aerr := range errs {
+			assert.Equal(t, i+1, aerr.Attempt)
+			assert.False(t, aerr.Time.Before(start))
+		}
+		assert.Equal(t, &codeError{code: 3}, errs.Last())
+
+		var cerr *codeError
+		assert.ErrorAs(t, err, &cerr)
+		assert.Equal(t, 1, cerr.code)
+	})
+
+	t.Run("collect permanent error cause", func(t *testing.T) {
+		cause := errors.New("not found")
+		err := Times(3).WithAllErrors().Do(func() error {
+			return Permanent(cause)
+		})
+		var errs Errors
+		assert.ErrorAs(t, err, &errs)
+		assert.Len(t, errs, 1)
+		assert.Same(t, cause, errs.Last())
+		assert.ErrorIs(t, err, cause)
+	})
+
+	t.Run("no error on success", func(t *testing.T) {
+		var count int
+		err := Times(3).WithAllErrors().Do(func() error {
+			count++
+			if count < 2 {
+				return errors.New("test err")
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,129 @@
+package retry
+
+import (
+	"context"
+	"time"
+)
+
+// WithHedge enables the hedged mode: the first attempt starts immediately, and if it
+// has not finished after the given delay, the next attempt starts concurrently, and so on
+// up to Times attempts. A failed attempt starts the next one right away. The first
+// success is returned and the context of the other attempts is canceled, so the func
+// should use DoContext to observe it. The Backoff is not used in hedged mode.
+func (r *Retry) WithHedge(delay time.Duration) *Retry {
+	c := r.clone()
+	c.hedgeDelay = delay
+	return c
+}
+
+type hedgeResult struct {
+	attempt int
+	err     error
+}
+
+func (r *Retry) runHedged(fn func(ctx context.Context, attempt int) error, stats *Stats) error {
+	var (
+		err      error
+		errs     Errors
+		launched int
+		inflight int
+	)
+	parent := r.context()
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	clock := r.getClock()
+	start := clock.Now()
+
+	results := make(chan hedgeResult)
+	done := make(chan struct{})
+	defer close(done)
+
+	exhausted := false
+	launch := func() bool {
+		if !r.unlimited() && launched >= r.times {
+			return false
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if r.maxElapsed > 0 && clock.Now().Sub(start) >= r.maxElapsed {
+			return false
+		}
+		if r.budget != nil {
+			if launched == 0 {
+				r.budget.Request()
+			} else if !r.budget.Withdraw() {
+				exhausted = true
+				return false
+			}
+		}
+		launched++
+		inflight++
+		stats.Attempts = launched
+		go func(attempt int) {
+			res := hedgeResult{attempt: attempt}
+			if r.limiter != nil {
+				// stops the retries like the sequential mode
+				res.err = Permanent(r.limiter.Wait(ctx))
+			}
+			if res.err == nil {
+				res.err = r.attempt(ctx, attempt, fn)
+			}
+			select {
+			case results <- res:
+			case <-done:
+			}
+		}(launched)
+		return true
+	}
+	result := func() error {
+		return lastError(errs, err)
+	}
+
+	if !launch() {
+		return parent.Err()
+	}
+	timer := clock.NewTimer(r.hedgeDelay)
+	defer timer.Stop()
+	for inflight > 0 {
+		select {
+		case res := <-results:
+			inflight--
+			stats.LastErr = res.err
+			if res.err == nil {
+				return nil
+			}
+			retryable := r.shouldRetry(res.err)
+			err = res.err
+			if !retryable {
+				err = unwrapPermanent(err)
+				stats.LastErr = err
+			}
+			if r.allErrors {
+				errs = append(errs, &AttemptError{Attempt: res.attempt, Time: clock.Now(), Err: err})
+			}
+			if !retryable {
+				return result()
+			}
+			if r.onRetry != nil && (r.unlimited() || launched < r.times) {
+				r.onRetry(res.attempt, err, 0)
+			}
+			if launch() {
+				timer.Reset(r.hedgeDelay)
+			}
+		case <-timer.C():
+			if launch() {
+				timer.Reset(r.hedgeDelay)
+			}
+		case <-parent.Done():
+			if err == nil {
+				err = parent.Err()
+			}
+			return result()
+		}
+	}
+	if exhausted {
+		return budgetExhausted(errs, err)
+	}
+	return result()
+}
@@ -0,0 +1,94 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithHedge(t *testing.T) {
+	t.Run("return the first success and cancel the others", func(t *testing.T) {
+		var (
+			started  atomic.Int32
+			canceled atomic.Int32
+		)
+		v, err := DoValue(Times(3).WithHedge(10*time.Millisecond), func(ctx context.Context) (int, error) {
+			n := started.Add(1)
+			if n == 1 {
+				<-ctx.Done()
+				canceled.Add(1)
+				return 0, ctx.Err()
+			}
+			return int(n), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, v)
+		assert.Eventually(t, func() bool {
+			return canceled.Load() == 1
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, int32(2), started.Load())
+	})
+
+	t.Run("capped by times", func(t *testing.T) {
+		var (
+			started atomic.Int32
+			stats   Stats
+		)
+		err := Times(3).
+			WithHedge(time.Millisecond).
+			WithStats(&stats).
+			DoContext(func(ctx context.Context, attempt int) error {
+				started.Add(1)
+				time.Sleep(20 * time.Millisecond)
+				return errors.New("test err")
+			})
+		assert.Equal(t, "test err", err.Error())
+		assert.Equal(t, int32(3), started.Load())
+		assert.Equal(t, 3, stats.Attempts)
+	})
+
+	t.Run("failure starts the next attempt", func(t *testing.T) {
+		var attempts []int
+		start := time.Now()
+		err := Times(3).
+			WithHedge(time.Hour).
+			WithAllErrors().
+			DoContext(func(_ context.Context, attempt int) error {
+				attempts = append(attempts, attempt)
+				return errors.New("test err")
+			})
+		var errs Errors
+		assert.ErrorAs(t, err, &errs)
+		assert.Len(t, errs, 3)
+		assert.Equal(t, []int{1, 2, 3}, attempts)
+		assert.True(t, time.Since(start) < time.Second)
+	})
+
+	t.Run("stop on permanent error", func(t *testing.T) {
+		cause := errors.New("not found")
+		var started atomic.Int32
+		err := Times(3).WithHedge(time.Hour).Do(func() error {
+			started.Add(1)
+			return Permanent(cause)
+		})
+		assert.Same(t, cause, err)
+		assert.Equal(t, int32(1), started.Load())
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+		err := Times(3).WithHedge(time.Hour).WithContext(ctx).DoContext(func(ctx context.Context, _ int) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
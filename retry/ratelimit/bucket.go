@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/shipengqi/golib/timeutil"
+)
+
+// TokenBucket is a Limiter that allows events at the given rate with bursts of
+// at most burst events. It is safe for concurrent use.
+type TokenBucket struct {
+	mu     sync.Mutex
+	clock  timeutil.Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full TokenBucket that refills rate tokens per second
+// and holds at most burst tokens.
+func NewTokenBucket(rate float64, burst int, opts ...Option) *TokenBucket {
+	o := newOptions(opts)
+	return &TokenBucket{
+		clock:  o.clock,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   o.clock.Now(),
+	}
+}
+
+// Allow reports whether a token is available now, and takes it if so.
+func (b *TokenBucket) Allow() bool {
+	return b.reserve(b.clock.Now(), 0).OK()
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	return wait(ctx, b.clock, b.reserve)
+}
+
+// Reserve takes a token that may be available in the future.
+func (b *TokenBucket) Reserve() *Reservation {
+	return b.reserve(b.clock.Now(), -1)
+}
+
+// Tokens returns the number of tokens available now.
+func (b *TokenBucket) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(b.clock.Now())
+	return b.tokens
+}
+
+func (b *TokenBucket) reserve(now time.Time, maxWait time.Duration) *Reservation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	tokens := b.tokens - 1
+	var delay time.Duration
+	if tokens < 0 {
+		if b.rate <= 0 {
+			return &Reservation{}
+		}
+		seconds := -tokens / b.rate
+		if seconds >= math.MaxInt64/float64(time.Second) {
+			return &Reservation{}
+		}
+		delay = time.Duration(seconds * float64(time.Second))
+	}
+	if maxWait >= 0 && delay > maxWait {
+		return &Reservation{}
+	}
+	b.tokens = tokens
+	return &Reservation{
+		ok:    true,
+		delay: delay,
+		cancel: func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.advance(b.clock.Now())
+			b.tokens = min(b.burst, b.tokens+1)
+		},
+	}
+}
+
+// advance refills the tokens since the last update.
+func (b *TokenBucket) advance(now time.Time) {
+	if !now.After(b.last) {
+		return
+	}
+	elapsed := now.Sub(b.last)
+	b.last = now
+	b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+}
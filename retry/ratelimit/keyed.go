@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shipengqi/golib/timeutil"
+)
+
+// Keyed holds a Limiter per key, such as a client IP or a tenant, and evicts
+// the limiters that have not been used for the idle duration.
+// It is safe for concurrent use.
+type Keyed[K comparable] struct {
+	mu         sync.Mutex
+	clock      timeutil.Clock
+	newLimiter func() Limiter
+	idle       time.Duration
+	lastSweep  time.Time
+	limiters   map[K]*keyedLimiter
+}
+
+type keyedLimiter struct {
+	limiter  Limiter
+	lastUsed time.Time
+}
+
+// NewKeyed creates a Keyed that creates the limiter of a key with newLimiter,
+// an idle less than or equal to zero means the limiters are never evicted.
+func NewKeyed[K comparable](newLimiter func() Limiter, idle time.Duration, opts ...Option) *Keyed[K] {
+	o := newOptions(opts)
+	return &Keyed[K]{
+		clock:      o.clock,
+		newLimiter: newLimiter,
+		idle:       idle,
+		lastSweep:  o.clock.Now(),
+		limiters:   make(map[K]*keyedLimiter),
+	}
+}
+
+// Get returns the Limiter of the given key, creates it if it does not exist.
+func (k *Keyed[K]) Get(key K) Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.clock.Now()
+	k.sweep(now)
+	l, ok := k.limiters[key]
+	if !ok {
+		l = &keyedLimiter{limiter: k.newLimiter()}
+		k.limiters[key] = l
+	}
+	l.lastUsed = now
+	return l.limiter
+}
+
+// Allow is a shortcut for Get(key).Allow().
+func (k *Keyed[K]) Allow(key K) bool {
+	return k.Get(key).Allow()
+}
+
+// Wait is a shortcut for Get(key).Wait(ctx).
+func (k *Keyed[K]) Wait(ctx context.Context, key K) error {
+	return k.Get(key).Wait(ctx)
+}
+
+// Reserve is a shortcut for Get(key).Reserve().
+func (k *Keyed[K]) Reserve(key K) *Reservation {
+	return k.Get(key).Reserve()
+}
+
+// Len returns the number of limiters held.
+func (k *Keyed[K]) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.sweep(k.clock.Now())
+	return len(k.limiters)
+}
+
+// sweep evicts the idle limiters, at most once per idle duration.
+func (k *Keyed[K]) sweep(now time.Time) {
+	if k.idle <= 0 || now.Sub(k.lastSweep) < k.idle {
+		return
+	}
+	k.lastSweep = now
+	for key, l := range k.limiters {
+		if now.Sub(l.lastUsed) >= k.idle {
+			delete(k.limiters, key)
+		}
+	}
+}
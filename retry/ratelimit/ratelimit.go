@@ -0,0 +1,108 @@
+// Package ratelimit provides token bucket and sliding window rate limiters,
+// they can be attached to retry.Retry with WithLimiter.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shipengqi/golib/timeutil"
+)
+
+var (
+	// ErrLimitExceeded is returned by Wait when the wait would exceed the context deadline,
+	// or when the limiter can never allow the event.
+	ErrLimitExceeded = errors.New("ratelimit: limit exceeded")
+)
+
+// Limiter controls how frequently events are allowed to happen.
+type Limiter interface {
+	// Allow reports whether an event may happen now, and consumes it if so.
+	Allow() bool
+	// Wait blocks until an event is allowed or ctx is done.
+	Wait(ctx context.Context) error
+	// Reserve reserves an event, the caller must wait Reservation.Delay before acting,
+	// or call Reservation.Cancel to give the event back.
+	Reserve() *Reservation
+}
+
+// Reservation holds an event reserved by Limiter.Reserve.
+type Reservation struct {
+	ok     bool
+	delay  time.Duration
+	cancel func()
+}
+
+// OK reports whether the event can be allowed at all.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long the caller must wait before the event happens.
+func (r *Reservation) Delay() time.Duration {
+	return r.delay
+}
+
+// Cancel gives the reserved event back to the limiter.
+func (r *Reservation) Cancel() {
+	if !r.ok || r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.cancel = nil
+}
+
+// Option configures a limiter.
+type Option func(o *options)
+
+type options struct {
+	clock timeutil.Clock
+}
+
+// WithClock sets the Clock, defaults to the wall clock.
+func WithClock(clock timeutil.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{clock: timeutil.RealClock()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// reserveFunc reserves an event that must happen within maxWait, maxWait less than
+// zero means no limit.
+type reserveFunc func(now time.Time, maxWait time.Duration) *Reservation
+
+// wait implements Limiter.Wait on top of reserveFunc.
+func wait(ctx context.Context, clock timeutil.Clock, reserve reserveFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := clock.Now()
+	maxWait := time.Duration(-1)
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = deadline.Sub(now)
+	}
+	r := reserve(now, maxWait)
+	if !r.OK() {
+		return ErrLimitExceeded
+	}
+	if r.Delay() <= 0 {
+		return nil
+	}
+	timer := clock.NewTimer(r.Delay())
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
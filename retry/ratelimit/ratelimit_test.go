@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/shipengqi/golib/retry"
+	"github.com/shipengqi/golib/timeutil"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t.Run("allow", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		b := NewTokenBucket(2, 2, WithClock(clock))
+		assert.True(t, b.Allow())
+		assert.True(t, b.Allow())
+		assert.False(t, b.Allow())
+
+		clock.Advance(500 * time.Millisecond)
+		assert.True(t, b.Allow())
+		assert.False(t, b.Allow())
+
+		// tokens are capped by the burst
+		clock.Advance(time.Hour)
+		assert.Equal(t, float64(2), b.Tokens())
+	})
+
+	t.Run("reserve", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		b := NewTokenBucket(1, 1, WithClock(clock))
+		r := b.Reserve()
+		assert.True(t, r.OK())
+		assert.Equal(t, time.Duration(0), r.Delay())
+
+		r = b.Reserve()
+		assert.True(t, r.OK())
+		assert.Equal(t, time.Second, r.Delay())
+		r.Cancel()
+
+		r = b.Reserve()
+		assert.Equal(t, time.Second, r.Delay())
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		b := NewTokenBucket(1, 1, WithClock(clock))
+		assert.NoError(t, b.Wait(context.Background()))
+
+		done := make(chan error)
+		go func() {
+			done <- b.Wait(context.Background())
+		}()
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("wait exceeds deadline", func(t *testing.T) {
+		b := NewTokenBucket(0.001, 1)
+		assert.True(t, b.Allow())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.ErrorIs(t, b.Wait(ctx), ErrLimitExceeded)
+	})
+
+	t.Run("zero rate", func(t *testing.T) {
+		b := NewTokenBucket(0, 1)
+		assert.True(t, b.Allow())
+		assert.False(t, b.Reserve().OK())
+	})
+}
+
+func TestSlidingWindow(t *testing.T) {
+	t.Run("allow", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		w := NewSlidingWindow(2, time.Second, WithClock(clock))
+		assert.True(t, w.Allow())
+		clock.Advance(500 * time.Millisecond)
+		assert.True(t, w.Allow())
+		assert.False(t, w.Allow())
+
+		clock.Advance(500 * time.Millisecond)
+		assert.True(t, w.Allow())
+		assert.False(t, w.Allow())
+	})
+
+	t.Run("reserve", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		w := NewSlidingWindow(1, time.Second, WithClock(clock))
+		assert.Equal(t, time.Duration(0), w.Reserve().Delay())
+		r := w.Reserve()
+		assert.True(t, r.OK())
+		assert.Equal(t, time.Second, r.Delay())
+		assert.Equal(t, 2*time.Second, w.Reserve().Delay())
+
+		clock.Advance(time.Second)
+		assert.Equal(t, 2*time.Second, w.Reserve().Delay())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		w := NewSlidingWindow(1, time.Second, WithClock(clock))
+		r := w.Reserve()
+		r.Cancel()
+		assert.True(t, w.Allow())
+	})
+
+	t.Run("wait canceled", func(t *testing.T) {
+		clock := timeutil.NewFakeClock(time.Now())
+		w := NewSlidingWindow(1, time.Hour, WithClock(clock))
+		assert.True(t, w.Allow())
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- w.Wait(ctx)
+		}()
+		clock.BlockUntil(1)
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+		clock.Advance(time.Hour)
+		assert.True(t, w.Allow())
+		assert.False(t, w.Allow())
+	})
+}
+
+func TestKeyed(t *testing.T) {
+	clock := timeutil.NewFakeClock(time.Now())
+	k := NewKeyed[string](func() Limiter {
+		return NewTokenBucket(1, 1, WithClock(clock))
+	}, time.Minute, WithClock(clock))
+
+	assert.True(t, k.Allow("a"))
+	assert.False(t, k.Allow("a"))
+	assert.True(t, k.Allow("b"))
+	assert.Equal(t, 2, k.Len())
+
+	clock.Advance(30 * time.Second)
+	assert.True(t, k.Reserve("a").OK())
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, 1, k.Len())
+	assert.NoError(t, k.Wait(context.Background(), "b"))
+}
+
+func TestRetryWithLimiter(t *testing.T) {
+	clock := timeutil.NewFakeClock(time.Now())
+	limiter := NewTokenBucket(1, 1, WithClock(clock))
+
+	var count int
+	done := make(chan error)
+	go func() {
+		done <- retry.Times(3).WithLimiter(limiter).Do(func() error {
+			count++
+			return errors.New("test err")
+		})
+	}()
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+	}
+	assert.Error(t, <-done)
+	assert.Equal(t, 3, count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := retry.Times(3).WithLimiter(limiter).WithContext(ctx).Do(func() error {
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
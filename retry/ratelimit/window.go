@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shipengqi/golib/timeutil"
+)
+
+// SlidingWindow is a Limiter that allows at most limit events in any window of
+// the given duration. It is safe for concurrent use.
+type SlidingWindow struct {
+	mu     sync.Mutex
+	clock  timeutil.Clock
+	limit  int
+	window time.Duration
+	// events holds the sorted times of the events in the window,
+	// including the ones reserved in the future.
+	events []time.Time
+}
+
+// NewSlidingWindow creates a SlidingWindow that allows limit events per window.
+func NewSlidingWindow(limit int, window time.Duration, opts ...Option) *SlidingWindow {
+	o := newOptions(opts)
+	return &SlidingWindow{
+		clock:  o.clock,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Allow reports whether an event may happen now, and records it if so.
+func (w *SlidingWindow) Allow() bool {
+	return w.reserve(w.clock.Now(), 0).OK()
+}
+
+// Wait blocks until an event is allowed or ctx is done.
+func (w *SlidingWindow) Wait(ctx context.Context) error {
+	return wait(ctx, w.clock, w.reserve)
+}
+
+// Reserve reserves the earliest time at which an event is allowed.
+func (w *SlidingWindow) Reserve() *Reservation {
+	return w.reserve(w.clock.Now(), -1)
+}
+
+func (w *SlidingWindow) reserve(now time.Time, maxWait time.Duration) *Reservation {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.limit <= 0 {
+		return &Reservation{}
+	}
+	w.prune(now)
+	at := now
+	if n := len(w.events); n >= w.limit {
+		if next := w.events[n-w.limit].Add(w.window); next.After(at) {
+			at = next
+		}
+	}
+	delay := at.Sub(now)
+	if maxWait >= 0 && delay > maxWait {
+		return &Reservation{}
+	}
+	i, _ := slices.BinarySearchFunc(w.events, at, func(e, t time.Time) int {
+		return e.Compare(t)
+	})
+	w.events = slices.Insert(w.events, i, at)
+	return &Reservation{
+		ok:    true,
+		delay: delay,
+		cancel: func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if i := slices.IndexFunc(w.events, at.Equal); i >= 0 {
+				w.events = slices.Delete(w.events, i, i+1)
+			}
+		},
+	}
+}
+
+// prune drops the events that are out of the window.
+func (w *SlidingWindow) prune(now time.Time) {
+	start := now.Add(-w.window)
+	i := 0
+	for i < len(w.events) && !w.events[i].After(start) {
+		i++
+	}
+	w.events = slices.Delete(w.events, 0, i)
+}
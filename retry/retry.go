@@ -3,77 +3,361 @@ package retry
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/shipengqi/golib/timeutil"
 )
 
+// Unlimited makes Retry retry until success, it is usually used along with
+// WithMaxElapsed or WithContext to bound the retries.
+const Unlimited = -1
+
+// Retry is an immutable retry policy, the With* methods return a copy of the
+// policy with the option applied. A Retry can be run many times concurrently,
+// each run keeps its own attempt counter.
 type Retry struct {
-	ctx      context.Context
-	interval time.Duration
-	times    int
+	ctx       context.Context
+	backoff   Backoff
+	retryable func(error) bool
+	times     int
+	allErrors bool
+
+	attemptTimeout time.Duration
+	maxElapsed     time.Duration
+	hedgeDelay     time.Duration
+
+	clock     timeutil.Clock
+	budget    Budget
+	limiter   Limiter
+	stats     *Stats
+	onRetry   func(attempt int, err error, next time.Duration)
+	onGiveUp  func(attempt int, err error)
+	onSuccess func(attempt int)
+}
+
+// Stats records how a run of Retry went.
+type Stats struct {
+	// Attempts is the number of attempts made.
+	Attempts int
+	// Slept is the total time spent waiting between attempts.
+	Slept time.Duration
+	// LastErr is the error of the last attempt, nil if it succeeded.
+	LastErr error
 }
 
-// Times creates a Retry with times.
+// Times creates a Retry with times, Unlimited means no limit and the other
+// negative values make no attempt.
 func Times(times int) *Retry {
-	r := &Retry{}
-	return r.Times(times)
+	return &Retry{times: times}
 }
 
-// Times sets the retry times.
+// Times sets the retry times, Unlimited means no limit.
 func (r *Retry) Times(times int) *Retry {
-	r.times = times
-	return r
+	c := r.clone()
+	c.times = times
+	return c
 }
 
-// WithInterval sets the retry interval.
+// WithInterval sets the retry interval, it is a shortcut for WithBackoff(Constant(interval)).
 func (r *Retry) WithInterval(interval time.Duration) *Retry {
-	r.interval = interval
-	return r
+	return r.WithBackoff(Constant(interval))
+}
+
+// WithBackoff sets the Backoff used to compute the delay between attempts.
+func (r *Retry) WithBackoff(backoff Backoff) *Retry {
+	c := r.clone()
+	c.backoff = backoff
+	return c
+}
+
+// RetryIf sets the predicate that reports whether the given error should be retried.
+// Errors created by Permanent or matching Unrecoverable are never retried.
+func (r *Retry) RetryIf(fn func(error) bool) *Retry {
+	c := r.clone()
+	c.retryable = fn
+	return c
+}
+
+// WithAllErrors makes Do return Errors that carries the error of every failed attempt,
+// instead of the last error only.
+func (r *Retry) WithAllErrors() *Retry {
+	c := r.clone()
+	c.allErrors = true
+	return c
 }
 
 // WithContext sets the retry context.
 func (r *Retry) WithContext(ctx context.Context) *Retry {
-	r.ctx = ctx
-	return r
+	c := r.clone()
+	c.ctx = ctx
+	return c
+}
+
+// WithAttemptTimeout sets the timeout of each attempt, the context passed to
+// the func of DoContext is canceled when the timeout expires.
+func (r *Retry) WithAttemptTimeout(timeout time.Duration) *Retry {
+	c := r.clone()
+	c.attemptTimeout = timeout
+	return c
+}
+
+// WithMaxElapsed sets the total time budget of a run. Retry stops once the elapsed time
+// plus the next delay would exceed the budget, an attempt in progress is not interrupted.
+func (r *Retry) WithMaxElapsed(d time.Duration) *Retry {
+	c := r.clone()
+	c.maxElapsed = d
+	return c
+}
+
+// WithClock sets the Clock used to measure the elapsed time and to wait between
+// attempts, defaults to the wall clock. The attempt timeout always uses the wall clock.
+func (r *Retry) WithClock(clock timeutil.Clock) *Retry {
+	c := r.clone()
+	c.clock = clock
+	return c
+}
+
+// WithBudget sets the Budget consulted before each retry, Do stops and returns
+// ErrBudgetExhausted along with the last error when the Budget refuses the retry.
+func (r *Retry) WithBudget(budget Budget) *Retry {
+	c := r.clone()
+	c.budget = budget
+	return c
+}
+
+// Limiter is the interface of a rate limiter, such as the limiters of the ratelimit package.
+type Limiter interface {
+	// Wait blocks until an event is allowed or ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// WithLimiter sets the Limiter that each attempt waits for before it starts.
+// Do stops if the wait fails.
+func (r *Retry) WithLimiter(limiter Limiter) *Retry {
+	c := r.clone()
+	c.limiter = limiter
+	return c
+}
+
+// WithStats sets the Stats that Do fills in, the Stats is reset at the start of each run.
+// Since the Stats is shared by the runs of the returned Retry, set it per run
+// when running concurrently.
+func (r *Retry) WithStats(stats *Stats) *Retry {
+	c := r.clone()
+	c.stats = stats
+	return c
+}
+
+// OnRetry sets the hook called after a failed attempt that will be retried,
+// next is the delay before the next attempt.
+func (r *Retry) OnRetry(fn func(attempt int, err error, next time.Duration)) *Retry {
+	c := r.clone()
+	c.onRetry = fn
+	return c
+}
+
+// OnGiveUp sets the hook called when Do stops retrying and returns an error,
+// attempt is the number of attempts made.
+func (r *Retry) OnGiveUp(fn func(attempt int, err error)) *Retry {
+	c := r.clone()
+	c.onGiveUp = fn
+	return c
+}
+
+// OnSuccess sets the hook called when an attempt succeeds.
+func (r *Retry) OnSuccess(fn func(attempt int)) *Retry {
+	c := r.clone()
+	c.onSuccess = fn
+	return c
 }
 
 // Do execute the given func with retry.
 func (r *Retry) Do(fn func() error) error {
+	return r.DoContext(func(context.Context, int) error {
+		return fn()
+	})
+}
+
+// DoContext is like Do but the given func receives the context of the attempt
+// and the attempt number which starts at 1. The context of the attempt is derived
+// from the context set by WithContext and bounded by WithAttemptTimeout.
+func (r *Retry) DoContext(fn func(ctx context.Context, attempt int) error) error {
+	stats := r.stats
+	if stats == nil {
+		stats = &Stats{}
+	}
+	*stats = Stats{}
 	var err error
-	for ; r.times > 0; r.times-- {
-		if r.isDone() {
+	if r.hedgeDelay > 0 {
+		err = r.runHedged(fn, stats)
+	} else {
+		err = r.run(fn, stats)
+	}
+	if err == nil {
+		// no attempt succeeded if none was made, like with Times(0)
+		if r.onSuccess != nil && stats.Attempts > 0 {
+			r.onSuccess(stats.Attempts)
+		}
+		return nil
+	}
+	if r.onGiveUp != nil {
+		r.onGiveUp(stats.Attempts, err)
+	}
+	return err
+}
+
+func (r *Retry) run(fn func(ctx context.Context, attempt int) error, stats *Stats) error {
+	var (
+		err   error
+		errs  Errors
+		delay time.Duration
+	)
+	ctx := r.context()
+	clock := r.getClock()
+	start := clock.Now()
+	for attempt := 1; r.unlimited() || attempt <= r.times; attempt++ {
+		if ctx.Err() != nil {
+			if err == nil {
+				err = ctx.Err()
+			}
 			break
 		}
-		if err = fn(); err != nil {
-			r.sleep()
-		} else {
+		if attempt == 1 && r.budget != nil {
+			r.budget.Request()
+		}
+		if r.limiter != nil {
+			if werr := r.limiter.Wait(ctx); werr != nil {
+				if err == nil {
+					err = werr
+				}
+				break
+			}
+		}
+		stats.Attempts = attempt
+		err = r.attempt(ctx, attempt, fn)
+		stats.LastErr = err
+		if err == nil {
+			return nil
+		}
+		retryable := r.shouldRetry(err)
+		if !retryable {
+			err = unwrapPermanent(err)
+			stats.LastErr = err
+		}
+		if r.allErrors {
+			errs = append(errs, &AttemptError{Attempt: attempt, Time: clock.Now(), Err: err})
+		}
+		if !retryable {
 			break
 		}
+		// no need to wait after the last attempt
+		if r.unlimited() || attempt < r.times {
+			delay = r.delay(attempt, delay)
+			wait := delay
+			// the delay provided by the server takes precedence
+			if d, ok := retryAfter(err); ok {
+				wait = d
+			}
+			if r.maxElapsed > 0 && clock.Now().Sub(start)+wait > r.maxElapsed {
+				break
+			}
+			if r.budget != nil && !r.budget.Withdraw() {
+				return budgetExhausted(errs, err)
+			}
+			if r.onRetry != nil {
+				r.onRetry(attempt, err, wait)
+			}
+			stats.Slept += sleep(ctx, clock, wait)
+		}
+	}
+	return lastError(errs, err)
+}
+
+// DoValue is like Retry.DoContext but the given func returns a value,
+// the value of the first successful attempt is returned.
+func DoValue[T any](r *Retry, fn func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	err := r.DoContext(func(ctx context.Context, _ int) error {
+		got, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		v = got
+		return nil
+	})
+	return v, err
+}
+
+func lastError(errs Errors, err error) error {
+	if len(errs) > 0 {
+		return errs
 	}
 	return err
 }
 
-func (r *Retry) isDone() bool {
+func budgetExhausted(errs Errors, err error) error {
+	return fmt.Errorf("%w: %w", ErrBudgetExhausted, lastError(errs, err))
+}
+
+func (r *Retry) unlimited() bool {
+	return r.times == Unlimited
+}
+
+func (r *Retry) clone() *Retry {
+	c := *r
+	return &c
+}
+
+func (r *Retry) getClock() timeutil.Clock {
+	if r.clock == nil {
+		return timeutil.RealClock()
+	}
+	return r.clock
+}
+
+func (r *Retry) context() context.Context {
 	if r.ctx == nil {
-		return false
+		return context.Background()
 	}
-	select {
-	case <-r.ctx.Done():
-		return true
-	default:
+	return r.ctx
+}
+
+func (r *Retry) attempt(ctx context.Context, attempt int, fn func(ctx context.Context, attempt int) error) error {
+	if r.attemptTimeout <= 0 {
+		return fn(ctx, attempt)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.attemptTimeout)
+	defer cancel()
+	return fn(ctx, attempt)
+}
+
+func (r *Retry) shouldRetry(err error) bool {
+	if errors.Is(err, Unrecoverable) {
 		return false
 	}
+	return r.retryable == nil || r.retryable(err)
 }
 
-func (r *Retry) sleep() {
-	if r.interval == 0 {
-		return
+func (r *Retry) delay(attempt int, prev time.Duration) time.Duration {
+	if r.backoff == nil {
+		return 0
 	}
-	if r.ctx == nil {
-		<-time.After(r.interval)
-		return
+	return r.backoff.Next(attempt, prev)
+}
+
+// sleep waits for the given duration or until ctx is done, returns the time slept.
+func sleep(ctx context.Context, clock timeutil.Clock, d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
 	}
+	start := clock.Now()
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
 	select {
-	case <-time.After(r.interval):
-	case <-r.ctx.Done():
+	case <-timer.C():
+	case <-ctx.Done():
 	}
+	return clock.Now().Sub(start)
 }
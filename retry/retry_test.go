@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/shipengqi/golib/timeutil"
 )
 
 func TestRetry(t *testing.T) {
@@ -46,3 +50,252 @@ func TestRetry(t *testing.T) {
 		assert.True(t, count >= 2)
 	})
 }
+
+func TestDoContext(t *testing.T) {
+	t.Run("pass attempt number", func(t *testing.T) {
+		var attempts []int
+		err := Times(3).DoContext(func(ctx context.Context, attempt int) error {
+			assert.NotNil(t, ctx)
+			attempts = append(attempts, attempt)
+			return errors.New("test err")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, []int{1, 2, 3}, attempts)
+	})
+
+	t.Run("attempt timeout", func(t *testing.T) {
+		var count int
+		err := Times(3).
+			WithAttemptTimeout(10 * time.Millisecond).
+			DoContext(func(ctx context.Context, attempt int) error {
+				count++
+				if attempt < 3 {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return nil
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var count int
+		err := Times(3).WithContext(ctx).DoContext(func(context.Context, int) error {
+			count++
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 0, count)
+	})
+}
+
+func TestDoValue(t *testing.T) {
+	t.Run("return value of the successful attempt", func(t *testing.T) {
+		var count int
+		v, err := DoValue(Times(3), func(context.Context) (string, error) {
+			count++
+			if count < 2 {
+				return "partial", errors.New("test err")
+			}
+			return "ok", nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", v)
+	})
+
+	t.Run("return zero value on error", func(t *testing.T) {
+		v, err := DoValue(Times(2), func(context.Context) (int, error) {
+			return 1, errors.New("test err")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 0, v)
+	})
+}
+
+func TestRetryReusable(t *testing.T) {
+	policy := Times(3)
+
+	t.Run("options do not change the policy", func(t *testing.T) {
+		_ = policy.Times(1).WithInterval(time.Hour).WithAllErrors()
+		var count int
+		err := policy.Do(func() error {
+			count++
+			return errors.New("test err")
+		})
+		assert.Equal(t, "test err", err.Error())
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("run concurrently", func(t *testing.T) {
+		var (
+			wg    sync.WaitGroup
+			total atomic.Int32
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var count int
+				_ = policy.Do(func() error {
+					count++
+					total.Add(1)
+					return errors.New("test err")
+				})
+				assert.Equal(t, 3, count)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(30), total.Load())
+	})
+}
+
+func TestRetryHooks(t *testing.T) {
+	t.Run("retry and success", func(t *testing.T) {
+		var (
+			retries []int
+			nexts   []time.Duration
+			success int
+			stats   Stats
+		)
+		var count int
+		err := Times(5).
+			WithInterval(time.Millisecond).
+			WithStats(&stats).
+			OnRetry(func(attempt int, err error, next time.Duration) {
+				assert.Error(t, err)
+				retries = append(retries, attempt)
+				nexts = append(nexts, next)
+			}).
+			OnGiveUp(func(int, error) {
+				t.Fatal("should not give up")
+			}).
+			OnSuccess(func(attempt int) {
+				success = attempt
+			}).
+			Do(func() error {
+				count++
+				if count < 3 {
+					return errors.New("test err")
+				}
+				return nil
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, retries)
+		assert.Equal(t, []time.Duration{time.Millisecond, time.Millisecond}, nexts)
+		assert.Equal(t, 3, success)
+		assert.Equal(t, 3, stats.Attempts)
+		assert.NoError(t, stats.LastErr)
+		assert.True(t, stats.Slept >= 2*time.Millisecond)
+	})
+
+	t.Run("give up", func(t *testing.T) {
+		var (
+			giveUp int
+			stats  Stats
+		)
+		cause := errors.New("test err")
+		err := Times(2).
+			WithStats(&stats).
+			OnGiveUp(func(attempt int, err error) {
+				giveUp = attempt
+				assert.Same(t, cause, err)
+			}).
+			OnSuccess(func(int) {
+				t.Fatal("should not succeed")
+			}).
+			Do(func() error {
+				return cause
+			})
+		assert.Same(t, cause, err)
+		assert.Equal(t, 2, giveUp)
+		assert.Equal(t, Stats{Attempts: 2, LastErr: cause}, stats)
+	})
+
+	t.Run("no attempt", func(t *testing.T) {
+		for _, times := range []int{0, -2} {
+			err := Times(times).
+				OnSuccess(func(int) {
+					t.Fatal("should not succeed")
+				}).
+				Do(func() error {
+					t.Fatal("should not be called")
+					return nil
+				})
+			assert.NoError(t, err)
+		}
+	})
+}
+
+func TestWithMaxElapsed(t *testing.T) {
+	t.Run("unlimited attempts bounded by budget", func(t *testing.T) {
+		var count int
+		start := time.Now()
+		err := Times(Unlimited).
+			WithInterval(10 * time.Millisecond).
+			WithMaxElapsed(100 * time.Millisecond).
+			Do(func() error {
+				count++
+				return errors.New("test err")
+			})
+		assert.Equal(t, "test err", err.Error())
+		assert.True(t, count > 1)
+		assert.True(t, time.Since(start) <= 100*time.Millisecond+50*time.Millisecond)
+	})
+
+	t.Run("stop when the next delay exceeds budget", func(t *testing.T) {
+		var count int
+		start := time.Now()
+		err := Times(5).
+			WithInterval(time.Second).
+			WithMaxElapsed(500 * time.Millisecond).
+			Do(func() error {
+				count++
+				return errors.New("test err")
+			})
+		assert.Error(t, err)
+		assert.Equal(t, 1, count)
+		assert.True(t, time.Since(start) < 500*time.Millisecond)
+	})
+
+	t.Run("unlimited attempts until success", func(t *testing.T) {
+		var count int
+		err := Times(Unlimited).Do(func() error {
+			count++
+			if count < 10 {
+				return errors.New("test err")
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 10, count)
+	})
+}
+
+func TestWithClock(t *testing.T) {
+	clock := timeutil.NewFakeClock(time.Now())
+	var (
+		stats Stats
+		count int
+	)
+	done := make(chan error)
+	go func() {
+		done <- Times(3).
+			WithInterval(time.Hour).
+			WithClock(clock).
+			WithStats(&stats).
+			Do(func() error {
+				count++
+				return errors.New("test err")
+			})
+	}()
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+	}
+	assert.Error(t, <-done)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 2*time.Hour, stats.Slept)
+}
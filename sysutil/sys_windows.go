@@ -5,3 +5,8 @@ import "os"
 func fqdn() (string, error) {
 	return os.Hostname()
 }
+
+// PID get process ID
+func PID() int {
+	return os.Getpid()
+}
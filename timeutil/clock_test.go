@@ -0,0 +1,83 @@
+package timeutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("advance fires expired timers", func(t *testing.T) {
+		clock := NewFakeClock(start)
+		t1 := clock.NewTimer(time.Second)
+		t2 := clock.NewTimer(time.Minute)
+		assert.Equal(t, 2, clock.Waiters())
+
+		clock.Advance(time.Second)
+		assert.Equal(t, start.Add(time.Second), <-t1.C())
+		select {
+		case <-t2.C():
+			t.Fatal("timer should not fire")
+		default:
+		}
+		assert.Equal(t, 1, clock.Waiters())
+
+		assert.True(t, t2.Stop())
+		assert.False(t, t2.Stop())
+		clock.Advance(time.Hour)
+		assert.Equal(t, 0, clock.Waiters())
+		assert.Equal(t, start.Add(time.Hour+time.Second), clock.Now())
+	})
+
+	t.Run("reset timer", func(t *testing.T) {
+		clock := NewFakeClock(start)
+		timer := clock.NewTimer(time.Second)
+		assert.True(t, timer.Reset(time.Minute))
+		clock.Advance(time.Second)
+		assert.Equal(t, 1, clock.Waiters())
+		clock.Set(start.Add(time.Minute))
+		assert.Equal(t, start.Add(time.Minute), <-timer.C())
+
+		// a non-positive duration fires immediately
+		assert.False(t, timer.Reset(0))
+		assert.Equal(t, start.Add(time.Minute), <-timer.C())
+	})
+
+	t.Run("sleep until advanced", func(t *testing.T) {
+		clock := NewFakeClock(start)
+		done := make(chan struct{})
+		go func() {
+			clock.Sleep(time.Second)
+			close(done)
+		}()
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		<-done
+	})
+}
+
+func TestRealClock(t *testing.T) {
+	clock := RealClock()
+	now := clock.Now()
+	clock.Sleep(time.Millisecond)
+	<-clock.After(time.Millisecond)
+	timer := clock.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(t, timer.Stop())
+	assert.True(t, clock.Now().Sub(now) >= 3*time.Millisecond)
+}
+
+func TestFakeClockStopDrains(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	timer := clock.NewTimer(time.Second)
+	clock.Advance(time.Second)
+	assert.False(t, timer.Stop())
+	select {
+	case <-timer.C():
+		t.Fatal("stale time should be discarded")
+	default:
+	}
+}
@@ -9,7 +9,13 @@ import (
 // if mon = -1, indicate last month
 // if mon = 1, indicate next month
 func MonthIntervalTimeFromNum(mon int) (start, end string) {
-	year, month, _ := time.Now().Date()
+	return MonthIntervalTimeFromNumWithClock(RealClock(), mon)
+}
+
+// MonthIntervalTimeFromNumWithClock is like MonthIntervalTimeFromNum but the current
+// month is taken from the given Clock.
+func MonthIntervalTimeFromNumWithClock(clock Clock, mon int) (start, end string) {
+	year, month, _ := clock.Now().Date()
 	thisMonth := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
 	start = thisMonth.AddDate(0, mon, 0).Format("2006-01-02")
 	end = thisMonth.AddDate(0, mon+1, -1).Format("2006-01-02")
@@ -64,3 +64,25 @@ func TestMonthIntervalTimeFromMonTimeParam(t *testing.T) {
 		})
 	}
 }
+
+func TestMonthIntervalTimeFromNumWithClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 2, 15, 10, 0, 0, 0, time.Local))
+	tests := []struct {
+		mon   int
+		start string
+		end   string
+	}{
+		{0, "2024-02-01", "2024-02-29"},
+		{-1, "2024-01-01", "2024-01-31"},
+		{1, "2024-03-01", "2024-03-31"},
+		{-2, "2023-12-01", "2023-12-31"},
+	}
+
+	for _, v := range tests {
+		t.Run(fmt.Sprintf("mon %d", v.mon), func(t *testing.T) {
+			start, end := MonthIntervalTimeFromNumWithClock(clock, v.mon)
+			assert.Equal(t, v.start, start)
+			assert.Equal(t, v.end, end)
+		})
+	}
+}